@@ -0,0 +1,164 @@
+package loglogbeta
+
+import "math"
+
+// maxRank is the largest value AddHash can store in a register at the
+// default precision: the number of hash bits below the register index, plus
+// one.
+const maxRank = max + 1
+
+// rankCap is the largest value AddHash can store in llb's registers.
+func (llb *LogLogBeta) rankCap() int {
+	return 64 - int(llb.p) + 1
+}
+
+// EstimatedError returns the relative standard error of the current estimate,
+// taking the state of the registers into account rather than quoting the
+// asymptotic 1.04/sqrt(m) figure.
+//
+// While many registers are still empty the count is effectively a linear
+// count of the zero registers, which is more accurate than the asymptotic
+// bound, and the smaller linear-counting error is returned. If registers have
+// reached the largest value a 64-bit hash can produce, the sketch can no
+// longer tell larger populations apart and the error is inflated by the
+// fraction of such registers, becoming +Inf once all of them are. An empty
+// sketch is exact and reports 0.
+func (llb *LogLogBeta) EstimatedError() float64 {
+	h := &llb.hist
+	m := float64(llb.numRegisters())
+	ez := float64(h[0])
+	if ez == m {
+		return 0
+	}
+
+	err := 1.04 / math.Sqrt(m)
+	if ez > 0 {
+		// Standard error of linear counting at load factor t = n/m, with t
+		// itself estimated from the fraction of empty registers.
+		t := math.Log(m / ez)
+		if lc := math.Sqrt(math.Expm1(t)-t) / (t * math.Sqrt(m)); lc < err {
+			err = lc
+		}
+	}
+
+	saturated := 0.0
+	for val := llb.rankCap(); val < len(h); val++ {
+		saturated += float64(h[val])
+	}
+	if saturated == m {
+		return math.Inf(1)
+	}
+	return err / (1 - saturated/m)
+}
+
+// ErrorRate returns the asymptotic relative standard error of the sketch,
+// 1.04/sqrt(m) for its m registers: about 0.81% at the default precision
+// and 3.25% at precision 10. It depends only on the precision; see
+// EstimatedError for the error of the current estimate.
+func (llb *LogLogBeta) ErrorRate() float64 {
+	return 1.04 / math.Sqrt(float64(llb.numRegisters()))
+}
+
+// CardinalityWithBounds returns the estimate with a two-sided confidence
+// interval around it, treating the estimate as normally distributed with
+// the relative standard error EstimatedError reports. A confidence of 0.95
+// gives est·(1 ± 1.96·EstimatedError()), rounded outwards to integers and
+// with the lower bound clamped at 0. The interval is symmetric in relative terms and
+// only approximate for the first few elements.
+//
+// A confidence of 1 or more, or a saturated sketch, yields the bounds 0 and
+// math.MaxUint64; a confidence of 0 or less yields an empty interval at the
+// estimate.
+func (llb *LogLogBeta) CardinalityWithBounds(confidence float64) (est, lower, upper uint64) {
+	f := llb.CardinalityFloat()
+	est = toUint64(math.Round(f))
+	if !(confidence > 0) {
+		return est, est, est
+	}
+	if confidence >= 1 {
+		return est, 0, math.MaxUint64
+	}
+	margin := math.Sqrt2 * math.Erfinv(confidence) * llb.EstimatedError() * f
+	if math.IsInf(margin, 0) || math.IsNaN(margin) {
+		return est, 0, math.MaxUint64
+	}
+	return est, toUint64(math.Floor(f - margin)), toUint64(math.Ceil(f + margin))
+}
+
+// collisionBudget is the share of the sketch's standard error that hash
+// collisions may contribute before RecommendedHashBits considers them
+// significant.
+const collisionBudget = 0.01
+
+// RecommendedHashBits returns the hash width, in bits, needed to keep hash
+// collisions negligible at the current estimated cardinality.
+//
+// n distinct elements hashed to b bits collide in roughly n²/2^(b+1) pairs,
+// so the count is biased low by a fraction of about n/2^(b+1). The result is
+// the smallest b for which that bias stays below 1% of the sketch's
+// 1.04/sqrt(m) standard error, and never less than the bits used for the
+// register index. A result approaching 64 means collisions in a 64-bit hash
+// are about to show up in the estimate.
+func (llb *LogLogBeta) RecommendedHashBits() int {
+	n := llb.CardinalityFloat()
+	if n < 1 {
+		return int(llb.p)
+	}
+	stdErr := 1.04 / math.Sqrt(float64(llb.numRegisters()))
+	bits := int(math.Ceil(math.Log2(n / (2 * collisionBudget * stdErr))))
+	if bits < int(llb.p) {
+		bits = int(llb.p)
+	}
+	return bits
+}
+
+// HeadroomToSaturation returns roughly how many more distinct elements the
+// sketch can absorb before its accuracy starts to degrade.
+//
+// A register stores at most 64-p+1, so once a noticeable share of registers
+// sees elements with 64-p leading zeros they can no longer tell larger
+// counts apart. Following the HyperLogLog rule of thumb for the range
+// correction, that sets in around m·2^(64-p)/30 elements, about 6·10^17 with
+// a 64-bit hash at the default precision.
+// The result is that point minus the current estimate, or 0 past it. It
+// inherits the estimate's error and is meant as an early warning for
+// resharding, not as an exact budget.
+func (llb *LogLogBeta) HeadroomToSaturation() uint64 {
+	sat := float64(llb.numRegisters()) * math.Exp2(float64(64-int(llb.p))) / 30
+	est := llb.estimate()
+	if est >= sat {
+		return 0
+	}
+	return toUint64(sat - est)
+}
+
+// MaxRegister returns the largest register value, 0 for an empty sketch.
+// Registers top out at 64-p+1 for a 64-bit hash, so a value close to that
+// means the sketch is near the top of its representable range. It reads the
+// register counts the sketch maintains rather than scanning the registers,
+// so it costs far less than a full pass.
+func (llb *LogLogBeta) MaxRegister() uint8 {
+	for val := len(llb.hist) - 1; val > 0; val-- {
+		if llb.hist[val] != 0 {
+			return uint8(val)
+		}
+	}
+	return 0
+}
+
+// LinearCount returns the linear counting estimate m·ln(m/ez) computed from
+// the number of empty registers ez, rounded to the nearest integer. It is a
+// cross-check for Cardinality: the two agree closely while many registers
+// are empty, and linear counting is the most accurate estimator there, up to
+// about 2m elements (32768 at the default precision). Beyond that its error
+// grows quickly and Cardinality should be preferred. Once no register is
+// empty linear counting is undefined and LinearCount returns Cardinality
+// instead.
+func (llb *LogLogBeta) LinearCount() uint64 {
+	ez := float64(llb.hist[0])
+	if ez == 0 {
+		return llb.Cardinality()
+	}
+	m := float64(llb.numRegisters())
+	return toUint64(math.Round(m * math.Log(m/ez)))
+}
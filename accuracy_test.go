@@ -0,0 +1,263 @@
+package loglogbeta
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimatedError(t *testing.T) {
+	base := 1.04 / math.Sqrt(float64(m))
+
+	if got := New().EstimatedError(); got != 0 {
+		t.Errorf("empty sketch: expected 0, got %v", got)
+	}
+
+	small := buildRange(0, 1000).EstimatedError()
+	if !(small > 0 && small < base) {
+		t.Errorf("small sketch: expected error in (0, %v), got %v", base, small)
+	}
+	mid := buildRange(0, 20000).EstimatedError()
+	if !(mid > small && mid <= base) {
+		t.Errorf("mid-range sketch: expected error in (%v, %v], got %v", small, base, mid)
+	}
+	if got := buildRange(0, 1000000).EstimatedError(); got != base {
+		t.Errorf("full sketch: expected %v, got %v", base, got)
+	}
+
+	llb := buildRange(0, 1000000)
+	for i := 0; i < int(m)/2; i++ {
+		llb.registers[i] = maxRank
+	}
+	llb.recount()
+	if got := llb.EstimatedError(); math.Abs(got-2*base) > 1e-12 {
+		t.Errorf("half saturated: expected %v, got %v", 2*base, got)
+	}
+	for i := range llb.registers {
+		llb.registers[i] = maxRank
+	}
+	llb.recount()
+	if got := llb.EstimatedError(); !math.IsInf(got, 1) {
+		t.Errorf("fully saturated: expected +Inf, got %v", got)
+	}
+}
+
+// TestAccuracyByPrecision checks that the empirical relative error of every
+// supported precision stays within three standard errors of the theoretical
+// 1.04/sqrt(m) across cardinalities from m/8 to 16m, which exercises the
+// fitted beta coefficients of each precision. Run with -v to see the table.
+func TestAccuracyByPrecision(t *testing.T) {
+	scales := []float64{0.125, 0.5, 2, 8, 16}
+	const trials = 4
+
+	t.Logf("%9s %9s %10s %10s", "precision", "n", "rms error", "bound")
+	for p := uint8(MinPrecision); p <= MaxPrecision; p++ {
+		m := float64(uint64(1) << p)
+		bound := 3 * 1.04 / math.Sqrt(m)
+		rng := rand.New(rand.NewSource(int64(p)))
+		for _, scale := range scales {
+			n := int(scale * m)
+			sq := 0.0
+			for trial := 0; trial < trials; trial++ {
+				llb, err := NewWithPrecision(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < n; i++ {
+					llb.AddHash(rng.Uint64())
+				}
+				e := estimateError(llb.Cardinality(), uint64(n))
+				sq += e * e
+			}
+			rms := math.Sqrt(sq / trials)
+			t.Logf("%9d %9d %9.3f%% %9.3f%%", p, n, 100*rms, 100*bound)
+			if rms > bound {
+				t.Errorf("precision %d, n=%d: rms error %.3f%% exceeds %.3f%%", p, n, 100*rms, 100*bound)
+			}
+		}
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	if got := New().ErrorRate(); math.Abs(got-0.008125) > 1e-6 {
+		t.Errorf("default precision: expected 0.8125%%, got %v", got)
+	}
+	llb, _ := NewWithPrecision(10)
+	if got := llb.ErrorRate(); math.Abs(got-0.0325) > 1e-6 {
+		t.Errorf("precision 10: expected 3.25%%, got %v", got)
+	}
+}
+
+func TestCardinalityWithBounds(t *testing.T) {
+	// About 95% of the 95% intervals must contain the true count.
+	const n, trials = 50000, 200
+	rng := rand.New(rand.NewSource(3))
+	hits := 0
+	for trial := 0; trial < trials; trial++ {
+		llb := New()
+		for i := 0; i < n; i++ {
+			llb.AddHash(rng.Uint64())
+		}
+		est, lo, hi := llb.CardinalityWithBounds(0.95)
+		if est != llb.Cardinality() || lo > est || hi < est {
+			t.Fatalf("inconsistent bounds %d <= %d <= %d", lo, est, hi)
+		}
+		if lo <= n && n <= hi {
+			hits++
+		}
+	}
+	if cover := float64(hits) / trials; cover < 0.88 || cover > 0.995 {
+		t.Errorf("95%% intervals cover the true count %.1f%% of the time", 100*cover)
+	}
+
+	llb := buildRange(0, 10000)
+	est, lo, hi := llb.CardinalityWithBounds(0.5)
+	_, lo99, hi99 := llb.CardinalityWithBounds(0.99)
+	if lo99 >= lo || hi99 <= hi {
+		t.Errorf("99%% interval [%d, %d] should contain the 50%% one [%d, %d]", lo99, hi99, lo, hi)
+	}
+	if e, l, h := llb.CardinalityWithBounds(0); l != est || h != est || e != est {
+		t.Errorf("confidence 0: expected an empty interval at %d, got [%d, %d]", est, l, h)
+	}
+	if _, l, h := llb.CardinalityWithBounds(1); l != 0 || h != math.MaxUint64 {
+		t.Errorf("confidence 1: expected [0, MaxUint64], got [%d, %d]", l, h)
+	}
+	if e, l, h := New().CardinalityWithBounds(0.95); e != 0 || l != 0 || h != 0 {
+		t.Errorf("empty sketch: expected all zero, got %d [%d, %d]", e, l, h)
+	}
+}
+
+func TestRecommendedHashBits(t *testing.T) {
+	if got := New().RecommendedHashBits(); got != precision {
+		t.Errorf("empty: expected %d, got %d", precision, got)
+	}
+
+	small := buildRange(0, 1000).RecommendedHashBits()
+	large := buildRange(0, 1000000).RecommendedHashBits()
+	if small >= large {
+		t.Errorf("expected more bits for a larger set, got %d and %d", small, large)
+	}
+	// 1e6 ≈ 2^20 elements against a 1% share of a 0.8% error needs about
+	// 20 + 12.6 bits.
+	if large < 32 || large > 34 {
+		t.Errorf("1e6 elements: expected 32-34 bits, got %d", large)
+	}
+
+	// Push the estimate toward 2^50 by filling every register with a large
+	// value; 64 bits are no longer enough.
+	llb := New()
+	for i := range llb.registers {
+		llb.registers[i] = 40
+	}
+	llb.recount()
+	if got := llb.RecommendedHashBits(); got <= 64 {
+		t.Errorf("huge estimate %d: expected more than 64 bits, got %d",
+			llb.Cardinality(), got)
+	}
+}
+
+func TestHeadroomToSaturation(t *testing.T) {
+	sat := uint64(float64(m) * math.Exp2(max) / 30)
+	if got := New().HeadroomToSaturation(); got != sat {
+		t.Errorf("empty: expected %d, got %d", sat, got)
+	}
+
+	// At this magnitude float64 resolves steps of 128.
+	llb := buildRange(0, 100000)
+	if got, exp := llb.HeadroomToSaturation(), sat-llb.Cardinality(); got < exp-256 || got > exp+256 {
+		t.Errorf("expected about %d, got %d", exp, got)
+	}
+
+	full := New()
+	for i := range full.registers {
+		full.registers[i] = maxRank
+	}
+	full.recount()
+	if got := full.HeadroomToSaturation(); got != 0 {
+		t.Errorf("saturated: expected 0, got %d", got)
+	}
+}
+
+func TestMaxRegister(t *testing.T) {
+	if got := New().MaxRegister(); got != 0 {
+		t.Errorf("empty: expected 0, got %d", got)
+	}
+
+	llb := buildRange(0, 10000)
+	exp := uint8(0)
+	for _, v := range llb.registers {
+		if v > exp {
+			exp = v
+		}
+	}
+	if got := llb.MaxRegister(); got != exp {
+		t.Errorf("expected %d, got %d", exp, got)
+	}
+
+	llb.AddHash(0)
+	if got := llb.MaxRegister(); got != maxRank {
+		t.Errorf("expected %d after AddHash(0), got %d", maxRank, got)
+	}
+}
+
+// TestTransitionZone checks the range where HyperLogLog switches from linear
+// counting to the harmonic estimate, from about half of the registers empty
+// down to none. LogLog-Beta covers it with a single formula; the test pins
+// that it shows no bias there and is at least as accurate as linear
+// counting, so blending the two would not help. Run with -v to see the table.
+func TestTransitionZone(t *testing.T) {
+	const trials = 60
+	rng := rand.New(rand.NewSource(1))
+	mf := float64(m)
+
+	t.Logf("%7s %11s %10s %10s", "n", "zero frac", "beta rmse", "lc rmse")
+	for _, n := range []int{10000, 20000, 30000, 40000, 60000} {
+		var bias, betaSq, lcSq float64
+		for trial := 0; trial < trials; trial++ {
+			llb := New()
+			for i := 0; i < n; i++ {
+				llb.AddHash(rng.Uint64())
+			}
+			rel := llb.CardinalityFloat()/float64(n) - 1
+			lc := mf*math.Log(mf/float64(llb.hist[0]))/float64(n) - 1
+			bias += rel
+			betaSq += rel * rel
+			lcSq += lc * lc
+		}
+		bias /= trials
+		betaRMS, lcRMS := math.Sqrt(betaSq/trials), math.Sqrt(lcSq/trials)
+		t.Logf("%7d %11.3f %9.3f%% %9.3f%%", n, math.Exp(-float64(n)/mf), 100*betaRMS, 100*lcRMS)
+
+		// The mean of 60 trials has a standard error of about 0.1%.
+		if math.Abs(bias) > 0.003 {
+			t.Errorf("n=%d: mean relative bias %.3f%%", n, 100*bias)
+		}
+		if betaRMS > 1.05*lcRMS {
+			t.Errorf("n=%d: rms error %.3f%% worse than linear counting's %.3f%%", n, 100*betaRMS, 100*lcRMS)
+		}
+	}
+}
+
+func TestLinearCount(t *testing.T) {
+	if got := New().LinearCount(); got != 0 {
+		t.Errorf("empty: expected 0, got %d", got)
+	}
+	for _, n := range []int{100, 1000, 10000} {
+		llb := buildRange(0, n)
+		lc, card := llb.LinearCount(), llb.Cardinality()
+		if 100*estimateError(lc, card) > 1 {
+			t.Errorf("n=%d: linear count %d far from estimate %d", n, lc, card)
+		}
+		if 100*estimateError(lc, uint64(n)) > 3 {
+			t.Errorf("n=%d: linear count %d far from exact", n, lc)
+		}
+	}
+
+	full := buildRange(0, 300000)
+	if full.hist[0] != 0 {
+		t.Fatal("expected no empty registers")
+	}
+	if got := full.LinearCount(); got != full.Cardinality() {
+		t.Errorf("no empty registers: expected Cardinality %d, got %d", full.Cardinality(), got)
+	}
+}
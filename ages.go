@@ -0,0 +1,25 @@
+package loglogbeta
+
+// WithRegisterAges makes the sketch remember, for every register, which
+// AddHash call last raised it, so LastChangedAt can tie an unexpected
+// register value to the input that caused it. This is a debugging aid: it
+// adds eight bytes per register, costs a store on every register change, and
+// the ages are never serialized. Decoding a blob into the sketch clears
+// them.
+func WithRegisterAges() Option {
+	return func(llb *LogLogBeta) {
+		llb.ages = make([]uint64, 1<<llb.p)
+	}
+}
+
+// LastChangedAt returns the 1-based number of the AddHash call, counting
+// calls to Add and the other insert methods, that last raised register
+// index. It returns 0 if the register hasn't changed since the sketch was
+// created, reset or decoded, or if the sketch doesn't track ages. A register
+// raised by Merge reports the number of calls made before the merge.
+func (llb *LogLogBeta) LastChangedAt(index uint32) uint64 {
+	if llb.ages == nil {
+		return 0
+	}
+	return llb.ages[index]
+}
@@ -0,0 +1,94 @@
+package loglogbeta
+
+import "testing"
+
+func TestRegisterAges(t *testing.T) {
+	llb := New(WithRegisterAges())
+	k, _ := getPosVal(0x8000000000000000, precision)
+
+	llb.AddHash(1)                  // register 0
+	llb.AddHash(0x8000000000000000) // register k, rank maxRank
+	llb.AddHash(0x8000000000000001) // register k, lower rank: no change
+	if got := llb.LastChangedAt(0); got != 1 {
+		t.Errorf("register 0: expected 1, got %d", got)
+	}
+	if got := llb.LastChangedAt(uint32(k)); got != 2 {
+		t.Errorf("register %d: expected 2, got %d", k, got)
+	}
+	if got := llb.LastChangedAt(1); got != 0 {
+		t.Errorf("untouched register: expected 0, got %d", got)
+	}
+
+	// A lazy clone must not see the original's later changes.
+	fork := llb.LazyClone()
+	llb.AddHash(1 << max) // register 1, call 4
+	if fork.LastChangedAt(1) != 0 || llb.LastChangedAt(1) != 4 {
+		t.Error("ages are shared with a lazy clone")
+	}
+
+	// Merge stamps the number of calls made so far.
+	fork.Merge(buildRange(0, 10))
+	for i := range fork.registers {
+		if fork.registers[i] != 0 && fork.LastChangedAt(uint32(i)) == 0 {
+			t.Fatalf("register %d raised by Merge has no age", i)
+		}
+	}
+
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if fork.LastChangedAt(0) != 0 {
+		t.Error("decoding should clear the ages")
+	}
+
+	llb.Reset()
+	if llb.LastChangedAt(uint32(k)) != 0 {
+		t.Error("reset should clear the ages")
+	}
+	if New().LastChangedAt(0) != 0 {
+		t.Error("a sketch without ages should report 0")
+	}
+}
+
+// Decoding into a lazy clone replaces its ages, which must not clear the
+// ages of the sketch it was cloned from.
+func TestRegisterAgesLazyCloneDecode(t *testing.T) {
+	src := New(WithRegisterAges())
+	for i := 0; i < 100; i++ {
+		src.AddHash(uint64(i) << max)
+	}
+	before := src.LastChangedAt(99)
+	if before != 100 {
+		t.Fatalf("expected register 99 changed at call 100, got %d", before)
+	}
+
+	data, _ := New().MarshalBinary()
+	for name, decode := range map[string]func(*LogLogBeta) error{
+		"UnmarshalBinary":  func(c *LogLogBeta) error { return c.UnmarshalBinary(data) },
+		"UnmarshalCompact": func(c *LogLogBeta) error { d, _ := New().MarshalCompact(); return c.UnmarshalCompact(d) },
+		"SetRegisters":     func(c *LogLogBeta) error { return c.SetRegisters(make([]uint8, m)) },
+	} {
+		clone := src.LazyClone()
+		if err := decode(clone); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := src.LastChangedAt(99); got != before {
+			t.Errorf("%s into a lazy clone changed the source's age from %d to %d", name, before, got)
+		}
+	}
+
+	sparse := New(WithSparseRegisters())
+	sparse.AddHash(1 << max)
+	entries := append([]uint32(nil), sparse.entries...)
+	clone := sparse.LazyClone()
+	if err := clone.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(sparse.entries) != len(entries) || sparse.entries[0] != entries[0] {
+		t.Error("decoding into a lazy clone changed the source's sparse entries")
+	}
+}
@@ -0,0 +1,58 @@
+package loglogbeta
+
+// batchChunk is the number of values AddBatch hashes before updating the
+// registers.
+const batchChunk = 256
+
+// AddHashBatch inserts every hash in hashes, with the same result as calling
+// AddHash on each in turn. For a sketch with plain registers, the common
+// case, it updates them in a single tight loop that hoists the checks
+// AddHash makes per call. Other sketches, packed or sparse ones, those
+// sharing their registers with a lazy clone and those tracking register
+// ages or index uniformity, take the regular per-hash path.
+func (llb *LogLogBeta) AddHashBatch(hashes []uint64) {
+	if llb.sparse || llb.packed != nil || llb.shared || llb.ages != nil || llb.bins != nil {
+		for _, x := range hashes {
+			llb.AddHash(x)
+		}
+		return
+	}
+	llb.adds += uint64(len(hashes))
+	llb.calls += uint64(len(hashes))
+	regs, p := llb.registers, llb.p
+	for _, x := range hashes {
+		k, val := getPosVal(x, p)
+		if old := regs[k]; old < val {
+			llb.hist[old]--
+			llb.hist[val]++
+			regs[k] = val
+		}
+	}
+}
+
+// AddBatch inserts every value in values, with the same result as calling
+// Add on each in turn. Values are hashed a chunk at a time into a buffer on
+// the stack and the chunk is inserted with AddHashBatch, so AddBatch doesn't
+// allocate.
+func (llb *LogLogBeta) AddBatch(values [][]byte) {
+	var buf [batchChunk]uint64
+	for len(values) > 0 {
+		n := len(values)
+		if n > batchChunk {
+			n = batchChunk
+		}
+		for i, v := range values[:n] {
+			buf[i] = llb.hash(v)
+		}
+		llb.AddHashBatch(buf[:n])
+		values = values[n:]
+	}
+}
+
+// FromHashes returns a sketch created with opts holding every hash in
+// hashes, built in one pass with AddHashBatch.
+func FromHashes(hashes []uint64, opts ...Option) *LogLogBeta {
+	llb := New(opts...)
+	llb.AddHashBatch(hashes)
+	return llb
+}
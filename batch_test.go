@@ -0,0 +1,113 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestAddHashBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	hashes := make([]uint64, 50000)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+	}
+	hashes[0], hashes[1] = 0, ^uint64(0)
+
+	p10 := func() *LogLogBeta { llb, _ := NewWithPrecision(10); return llb }
+	configs := map[string]func() *LogLogBeta{
+		"plain":      func() *LogLogBeta { return New() },
+		"p10":        p10,
+		"packed":     func() *LogLogBeta { return New(WithPackedRegisters()) },
+		"sparse":     func() *LogLogBeta { return New(WithSparseRegisters()) },
+		"ages":       func() *LogLogBeta { return New(WithRegisterAges()) },
+		"uniformity": func() *LogLogBeta { return New(WithIndexUniformity()) },
+		"metadata":   func() *LogLogBeta { return New(WithMetadata()) },
+		"lazy clone": func() *LogLogBeta { return New().LazyClone() },
+	}
+	for name, mk := range configs {
+		exp, got := mk(), mk()
+		for _, x := range hashes[:100] {
+			exp.AddHash(x)
+		}
+		got.AddHashBatch(hashes[:100])
+		if !bytes.Equal(got.dense(), exp.dense()) {
+			t.Errorf("%s: batch of 100 differs from AddHash", name)
+		}
+		for _, x := range hashes[100:] {
+			exp.AddHash(x)
+		}
+		got.AddHashBatch(hashes[100:])
+		got.AddHashBatch(nil)
+		if !bytes.Equal(got.dense(), exp.dense()) || got.adds != exp.adds || got.calls != exp.calls {
+			t.Errorf("%s: batch differs from AddHash", name)
+		}
+		checkHist(t, name, got)
+	}
+
+	if llb := FromHashes(hashes[:10], WithSparseRegisters()); !llb.sparse {
+		t.Error("FromHashes ignored its options")
+	}
+	if llb := FromHashes(hashes, WithSparseRegisters()); !bytes.Equal(llb.dense(), FromHashes(hashes).dense()) {
+		t.Error("FromHashes depends on the register storage")
+	}
+	if got := FromHashes(hashes).Cardinality(); estimateError(got, uint64(len(hashes))) > 0.02 {
+		t.Errorf("FromHashes: expected about %d, got %d", len(hashes), got)
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	values := make([][]byte, 3*batchChunk+17)
+	for i := range values {
+		values[i] = []byte(strconv.Itoa(i))
+	}
+	for _, opts := range [][]Option{nil, {WithHasherXXHash()}} {
+		exp, got := New(opts...), New(opts...)
+		for _, v := range values {
+			exp.Add(v)
+		}
+		got.AddBatch(values)
+		if !bytes.Equal(got.registers, exp.registers) || got.adds != exp.adds {
+			t.Errorf("%s: AddBatch differs from Add", got.HashID())
+		}
+	}
+
+	llb := New()
+	hashes := []uint64{1, 2, 3}
+	if n := testing.AllocsPerRun(100, func() {
+		llb.AddBatch(values)
+		llb.AddHashBatch(hashes)
+	}); n != 0 {
+		t.Errorf("expected no allocations, got %.1f", n)
+	}
+}
+
+func batchHashes() []uint64 {
+	rng := rand.New(rand.NewSource(1))
+	hashes := make([]uint64, 1<<16)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+	}
+	return hashes
+}
+
+func BenchmarkAddHashLoop(b *testing.B) {
+	hashes := batchHashes()
+	llb := New()
+	b.SetBytes(int64(8 * len(hashes)))
+	for i := 0; i < b.N; i++ {
+		for _, x := range hashes {
+			llb.AddHash(x)
+		}
+	}
+}
+
+func BenchmarkAddHashBatch(b *testing.B) {
+	hashes := batchHashes()
+	llb := New()
+	b.SetBytes(int64(8 * len(hashes)))
+	for i := 0; i < b.N; i++ {
+		llb.AddHashBatch(hashes)
+	}
+}
@@ -0,0 +1,39 @@
+package loglogbeta
+
+import "math"
+
+// betaCoefficients holds the bias-correction polynomial of LogLog-Beta by
+// precision. Precision 14 uses the coefficients published with the
+// algorithm; the others were fitted the same way, by least squares on
+// simulated sketches, minimizing the relative error of the estimate over
+// every cardinality at which some register is still empty.
+var betaCoefficients = [MaxPrecision + 1][8]float64{
+	4:  {-1359.649554, 1360.329024, 671.1162549, 245.9332725, 34.21925291, 25.85407487, -3.305256611, 1.15907662},
+	5:  {-88.42024554, 88.50490927, 40.16419361, 22.10698507, -2.868011299, 3.8345605, -0.6783647942, 0.1154352436},
+	6:  {-56.93552088, 58.06758012, 20.72872346, 22.0471244, -7.71968123, 4.806312442, -0.9097471927, 0.1123947287},
+	7:  {7.907246933, -9.79588327, 0.1096766615, -6.348321822, 2.925171223, -1.268605229, 0.2260518316, -0.02259299939},
+	8:  {-3.185927403, 2.860702069, 0.474324137, 2.431383587, -1.305039285, 0.5562627043, -0.09769991772, 0.009008897532},
+	9:  {-1.405247036, 1.310803967, -0.7460048033, 2.277175877, -1.284347578, 0.4446215284, -0.0704030123, 0.005265438468},
+	10: {-0.7094265444, 0.786001957, -1.184445246, 2.012323923, -1.07324775, 0.3188584929, -0.04483108474, 0.002820458289},
+	11: {-0.4814327737, -1.07145507, 1.497055169, -0.1185023631, -0.216789758, 0.1099477553, -0.01770888756, 0.001179054305},
+	12: {-0.3981710573, -0.09673186891, 0.07541754237, 0.3645236135, -0.1760679737, 0.05242936862, -0.006681256323, 0.0004506953006},
+	13: {-0.4091316347, 1.106610854, -2.579316553, 2.685119037, -1.122408893, 0.2494448135, -0.0269278298, 0.001305755241},
+	14: {-0.370393911, 0.070471823, 0.17393686, 0.16339839, -0.09237745, 0.03738027, -0.005384159, 0.00042419},
+	15: {-0.3902605061, 1.849975934, -8.301993121, 7.56181338, -2.826426114, 0.543319439, -0.05198101406, 0.00218610396},
+	16: {-0.3927337, 13.21476194, -21.91155132, 15.45349408, -5.304790226, 0.9678173456, -0.08919817405, 0.003526960139},
+	17: {-0.374434204, 7.661820824, -18.7860854, 13.59203329, -4.600352126, 0.8352845415, -0.0776997549, 0.003162676247},
+	18: {-0.368102291, -2.00673624, -11.54668958, 12.88393913, -5.247341697, 1.041439814, -0.100724774, 0.004090001101},
+}
+
+// beta returns the bias correction for a sketch of precision p with ez
+// empty registers:
+//
+//	β(ez) = c0·ez + c1·zl + c2·zl² + ... + c7·zl⁷, zl = ln(ez+1)
+//
+// The polynomial is evaluated by Horner's rule rather than with math.Pow.
+func beta(ez float64, p uint8) float64 {
+	c := &betaCoefficients[p]
+	zl := math.Log(ez + 1)
+	return c[0]*ez +
+		zl*(c[1]+zl*(c[2]+zl*(c[3]+zl*(c[4]+zl*(c[5]+zl*(c[6]+zl*c[7]))))))
+}
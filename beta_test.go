@@ -0,0 +1,18 @@
+package loglogbeta
+
+import "testing"
+
+func TestBetaSingleElement(t *testing.T) {
+	// One element in an otherwise empty sketch must count as one at every
+	// precision, which fails if a precision lacks its coefficients.
+	for p := uint8(MinPrecision); p <= MaxPrecision; p++ {
+		llb, err := NewWithPrecision(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		llb.AddHash(1)
+		if got := llb.Cardinality(); got != 1 {
+			t.Errorf("precision %d: expected 1, got %d", p, got)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CollectionHeaderSize is the number of bytes CollectionWriter writes once
+// before the hash id and the first sketch.
+const CollectionHeaderSize = 16
+
+// collectionVersion is the version CollectionWriter writes. Version 1
+// collections, which don't record the hash id, are still read.
+const collectionVersion = 2
+
+var collectionMagic = [4]byte{'L', 'L', 'B', 'S'}
+
+var errCollectionMagic = errors.New("loglogbeta: not a sketch collection")
+
+// CollectionWriter writes a sequence of sketches that share a precision and
+// a hash, stating both once in a header instead of once per sketch. The
+// layout is:
+//
+//	offset  size  field
+//	0       4     magic "LLBS"
+//	4       1     format version (2)
+//	5       1     precision p
+//	6       1     length n of the hash id
+//	7       1     reserved, zero
+//	8       8     hash seed, big-endian: metro's seed, 0xadc83b19 for
+//	              WithHasherRedis and 0 for other hashes
+//	16      n     hash id as HashID returns it, empty for the default
+//	              metro hash
+//	16+n    2^p   registers of the first sketch, one byte each
+//	...           registers of each following sketch
+//
+// Every entry has the same size, so there is no per-entry framing and entry
+// i starts at offset 16 + n + i·2^p. Alpha and metadata are not stored.
+// Version 1 has no hash id; byte 6 is reserved and the first entry starts
+// at 16, and only the seed tells the hashes apart.
+type CollectionWriter struct {
+	w io.Writer
+	// tmpl holds the collection's precision and hash.
+	tmpl *LogLogBeta
+	err  error
+}
+
+// NewCollectionWriter writes the collection header to w and returns a
+// writer for the sketches. The precision and hash chosen by opts, by default
+// 14 and metro seeded with 1337, are recorded, along with the hash's seed,
+// and Write only accepts sketches built with both. Other options have no
+// effect.
+func NewCollectionWriter(w io.Writer, opts ...Option) (*CollectionWriter, error) {
+	tmpl := collectionTemplate(opts)
+	id := tmpl.hashID
+	hdr := make([]byte, CollectionHeaderSize, CollectionHeaderSize+len(id))
+	copy(hdr[0:4], collectionMagic[:])
+	hdr[4] = collectionVersion
+	hdr[5] = tmpl.p
+	hdr[6] = uint8(len(id))
+	binary.BigEndian.PutUint64(hdr[8:16], collectionSeed(id))
+	if _, err := w.Write(append(hdr, id...)); err != nil {
+		return nil, err
+	}
+	return &CollectionWriter{w: w, tmpl: tmpl}, nil
+}
+
+// collectionTemplate returns a sparse sketch holding the precision and hash
+// chosen by opts, which only allocates the few bytes that takes.
+func collectionTemplate(opts []Option) *LogLogBeta {
+	return New(append([]Option{WithSparseRegisters()}, opts...)...)
+}
+
+// collectionSeed returns the seed recorded for the hash with stored id id:
+// metro's seed, the Redis seed for WithHasherRedis and 0 for any other hash,
+// which only its id tells apart.
+func collectionSeed(id string) uint64 {
+	switch {
+	case id == "":
+		return defaultSeed
+	case id == "redis":
+		return redisSeed
+	case strings.HasPrefix(id, "metro:"):
+		seed, _ := strconv.ParseUint(id[len("metro:"):], 10, 64)
+		return seed
+	}
+	return 0
+}
+
+// Write appends llb's registers to the collection. It returns an
+// *IncompatibleError wrapping ErrPrecisionMismatch for a sketch of another
+// precision than the collection's and an error wrapping ErrHashMismatch for
+// one built with another hash. Once a write fails, every later call returns the same
+// error.
+func (cw *CollectionWriter) Write(llb *LogLogBeta) error {
+	if cw.err != nil {
+		return cw.err
+	}
+	if err := cw.tmpl.checkMergeable(llb); err != nil {
+		return err
+	}
+	_, cw.err = cw.w.Write(llb.dense())
+	return cw.err
+}
+
+// CollectionReader reads sketches written by a CollectionWriter.
+type CollectionReader struct {
+	r io.Reader
+	// tmpl holds the precision and hash of the sketches returned by Next.
+	tmpl *LogLogBeta
+}
+
+// NewCollectionReader reads and checks the collection header from r. The
+// collection must have been written with the precision and hash chosen by
+// opts, which the sketches returned by Next take on; other options have no
+// effect. It fails with an *IncompatibleError wrapping ErrPrecisionMismatch
+// for another precision, with an error wrapping ErrHashMismatch for another
+// hash and with an *IncompatibleError wrapping ErrSeedMismatch if the
+// recorded seed isn't that hash's. Version 1 collections don't record their
+// hash, so only the seed is checked.
+func NewCollectionReader(r io.Reader, opts ...Option) (*CollectionReader, error) {
+	var hdr [CollectionHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if [4]byte{hdr[0], hdr[1], hdr[2], hdr[3]} != collectionMagic {
+		return nil, errCollectionMagic
+	}
+	v := hdr[4]
+	if v != 1 && v != collectionVersion {
+		return nil, &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(v), Want: collectionVersion}
+	}
+	tmpl := collectionTemplate(opts)
+	if hdr[5] != tmpl.p {
+		return nil, &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(hdr[5]), Want: uint64(tmpl.p)}
+	}
+	if v > 1 {
+		id := make([]byte, hdr[6])
+		if _, err := io.ReadFull(r, id); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if err := tmpl.checkHash(storedID(string(id))); err != nil {
+			return nil, err
+		}
+	}
+	if got, want := binary.BigEndian.Uint64(hdr[8:16]), collectionSeed(tmpl.hashID); got != want {
+		return nil, &IncompatibleError{Err: ErrSeedMismatch, Got: got, Want: want}
+	}
+	return &CollectionReader{r: r, tmpl: tmpl}, nil
+}
+
+// Next returns the next sketch in the collection, or io.EOF after the last
+// one. A collection that ends partway through a sketch yields
+// io.ErrUnexpectedEOF.
+func (cr *CollectionReader) Next() (*LogLogBeta, error) {
+	regs := make([]uint8, 1<<cr.tmpl.p)
+	if _, err := io.ReadFull(cr.r, regs); err != nil {
+		return nil, err
+	}
+	llb, err := WrapRegisters(regs)
+	if err != nil {
+		return nil, err
+	}
+	llb.hash, llb.hashID = cr.tmpl.hash, cr.tmpl.hashID
+	return llb, nil
+}
@@ -0,0 +1,200 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	var want []*LogLogBeta
+	for i := 0; i < 5; i++ {
+		want = append(want, buildRange(i*1000, i*1000+2000))
+	}
+	want = append(want, New(), New(WithPackedRegisters()))
+
+	var buf bytes.Buffer
+	cw, err := NewCollectionWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, llb := range want {
+		if err := cw.Write(llb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exp := CollectionHeaderSize + len(want)*int(m); buf.Len() != exp {
+		t.Errorf("expected %d bytes, got %d", exp, buf.Len())
+	}
+	data := buf.Bytes()
+
+	cr, err := NewCollectionReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range want {
+		got, err := cr.Next()
+		if err != nil {
+			t.Fatalf("sketch %d: %v", i, err)
+		}
+		if !bytes.Equal(got.registers, exp.dense()) || got.Cardinality() != exp.Cardinality() {
+			t.Errorf("sketch %d differs", i)
+		}
+	}
+	if _, err := cr.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last sketch, got %v", err)
+	}
+
+	cr, _ = NewCollectionReader(bytes.NewReader(data[:len(data)-1]))
+	for i := 0; i < len(want)-1; i++ {
+		cr.Next()
+	}
+	if _, err := cr.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated sketch: expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestCollectionErrors(t *testing.T) {
+	var buf bytes.Buffer
+	cw, _ := NewCollectionWriter(&buf)
+	if err := cw.Write(&LogLogBeta{registers: make([]uint8, 16)}); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch, got %v", err)
+	}
+	hdr := buf.Bytes()
+	mutate := func(i int, v byte) []byte {
+		b := append([]byte(nil), hdr...)
+		b[i] = v
+		return b
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		is   error
+	}{
+		{"short", hdr[:10], io.ErrUnexpectedEOF},
+		{"empty", nil, io.ErrUnexpectedEOF},
+		{"magic", mutate(0, 'X'), errCollectionMagic},
+		{"version", mutate(4, 3), ErrVersionUnsupported},
+		{"precision", mutate(5, 12), ErrPrecisionMismatch},
+		{"seed", mutate(15, 0), ErrSeedMismatch},
+	}
+	for _, c := range cases {
+		if _, err := NewCollectionReader(bytes.NewReader(c.data)); !errors.Is(err, c.is) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.is, err)
+		}
+	}
+}
+
+func TestCollectionHashID(t *testing.T) {
+	xx := New(WithHasherXXHash())
+	xx.Add([]byte("x"))
+
+	var buf bytes.Buffer
+	cw, err := NewCollectionWriter(&buf, WithHasherXXHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Write(xx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Write(New()); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch writing a default sketch, got %v", err)
+	}
+	data := buf.Bytes()
+	if data[6] != 6 || len(data) != CollectionHeaderSize+len("xxhash")+int(m) {
+		t.Errorf("unexpected header % x or length %d", data[:CollectionHeaderSize], len(data))
+	}
+
+	if _, err := NewCollectionReader(bytes.NewReader(data)); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch reading with the default hash, got %v", err)
+	}
+	cr, err := NewCollectionReader(bytes.NewReader(data), WithHasherXXHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cr.Next()
+	if err != nil || got.HashID() != "xxhash" || !bytes.Equal(got.registers, xx.registers) {
+		t.Errorf("decoded sketch: %v, hash %q", err, got.HashID())
+	}
+	if err := got.Merge(xx); err != nil {
+		t.Errorf("decoded sketch doesn't merge with the original: %v", err)
+	}
+
+	// Version 1 collections have no hash id.
+	v1 := append([]byte(nil), data[:CollectionHeaderSize]...)
+	v1[4], v1[6] = 1, 0
+	v1 = append(v1, xx.registers...)
+	if _, err := NewCollectionReader(bytes.NewReader(v1)); !errors.Is(err, ErrSeedMismatch) {
+		t.Errorf("version 1: expected a seed mismatch reading with the default hash, got %v", err)
+	}
+	cr, err = NewCollectionReader(bytes.NewReader(v1), WithHasherXXHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cr.Next(); err != nil || !bytes.Equal(got.registers, xx.registers) {
+		t.Errorf("version 1: %v", err)
+	}
+
+	// The seed follows the hash.
+	for _, c := range []struct {
+		opt  Option
+		seed uint64
+	}{{WithHasherMetro(), 1337}, {WithHasherMetroSeed(42), 42}, {WithHasherRedis(), redisSeed}, {WithHasherXXHash(), 0}} {
+		buf.Reset()
+		if _, err := NewCollectionWriter(&buf, c.opt); err != nil {
+			t.Fatal(err)
+		}
+		if got := binary.BigEndian.Uint64(buf.Bytes()[8:16]); got != c.seed {
+			t.Errorf("expected seed %d, got %d", c.seed, got)
+		}
+	}
+}
+
+func TestCollectionPrecision(t *testing.T) {
+	var want []*LogLogBeta
+	for i := 0; i < 3; i++ {
+		llb := New(WithPrecision(10))
+		for j := 0; j < 500*(i+1); j++ {
+			llb.AddHash(uint64(j) * 0x9e3779b97f4a7c15)
+		}
+		want = append(want, llb)
+	}
+
+	var buf bytes.Buffer
+	cw, err := NewCollectionWriter(&buf, WithPrecision(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, llb := range want {
+		if err := cw.Write(llb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Write(New()); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch writing a default sketch, got %v", err)
+	}
+	data := buf.Bytes()
+	if data[5] != 10 || len(data) != CollectionHeaderSize+len(want)<<10 {
+		t.Errorf("unexpected precision %d or length %d", data[5], len(data))
+	}
+
+	if _, err := NewCollectionReader(bytes.NewReader(data)); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch reading with the default precision, got %v", err)
+	}
+	cr, err := NewCollectionReader(bytes.NewReader(data), WithPrecision(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range want {
+		got, err := cr.Next()
+		if err != nil || got.Precision() != 10 || !bytes.Equal(got.registers, exp.registers) {
+			t.Errorf("sketch %d: %v, precision %d", i, err, got.Precision())
+		}
+	}
+	if _, err := cr.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last sketch, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// CompactHeaderSize is the number of bytes preceding the hash id and the
+// registers in the compact encoding.
+const CompactHeaderSize = 8
+
+// compactVersion is the version MarshalCompact writes. Version 1 blobs,
+// which don't record the hash, are still read.
+const compactVersion = 2
+
+// Flag bits of the compact encoding. The other bits are reserved and must
+// be zero.
+const (
+	// compactChecksum marks a trailing checksum.
+	compactChecksum = 1 << 0
+	// compactRLE marks registers stored as runs rather than one byte each.
+	compactRLE = 1 << 1
+)
+
+var compactMagic = [4]byte{'L', 'L', 'B', 'C'}
+
+var (
+	errCompactShort = errors.New("loglogbeta: truncated compact encoding")
+	errCompactMagic = errors.New("loglogbeta: not a compact encoding")
+	errCompactFlags = errors.New("loglogbeta: unknown flags in compact encoding")
+	errCompactRuns  = errors.New("loglogbeta: corrupt register runs in compact encoding")
+)
+
+// MarshalCompact returns the compact encoding of llb, a self-describing
+// format meant to be read by other languages. Unlike MarshalBinary it
+// doesn't depend on gob, and the layout below is stable: a change to it
+// comes with a new version number. All multi-byte fields are big-endian.
+//
+//	offset    size  field
+//	0         4     magic "LLBC"
+//	4         1     format version (2)
+//	5         1     precision p; there are 2^p registers
+//	6         1     flags; bit 0 means a checksum follows the registers,
+//	                bit 1 that they are run-length encoded, bits 2-7 are
+//	                reserved and zero
+//	7         1     length n of the hash id
+//	8         n     hash id as HashID returns it, empty for the default
+//	                metro hash
+//	8+n       2^p   registers, one byte each, in index order
+//	8+n+2^p   4     CRC-32 (IEEE) of bytes 0 to 8+n+2^p-1, if flag bit 0 is
+//	                set
+//
+// With flag bit 1 set the registers are instead a sequence of runs, each an
+// unsigned LEB128 varint count of at least 1 followed by the register value
+// repeated that many times. The counts add up to exactly 2^p, and the
+// checksum, if any, covers the header, the hash id and the runs. Version 1
+// has no hash id; byte 7 is reserved and zero and the registers start at 8.
+// A register's index is the top p bits of the element's 64-bit hash and its
+// value is the number of leading zeros in the remaining 64-p bits plus one,
+// capped at 64-p+1, or zero if no element fell into it. Alpha and metadata
+// are not stored; alpha is recomputed from the precision when decoding.
+// MarshalCompact always sets the checksum flag and never the run-length
+// flag; see MarshalCompactRLE.
+func (llb *LogLogBeta) MarshalCompact() ([]byte, error) {
+	return llb.marshalCompact(false), nil
+}
+
+// MarshalCompactRLE is like MarshalCompact but run-length encodes the
+// registers. Runs of empty registers dominate a sketch of a few thousand
+// elements, which then takes a fraction of the 2^p bytes MarshalCompact
+// writes; a well-filled sketch has few runs longer than one and takes up to
+// twice as many.
+func (llb *LogLogBeta) MarshalCompactRLE() ([]byte, error) {
+	return llb.marshalCompact(true), nil
+}
+
+func (llb *LogLogBeta) marshalCompact(rle bool) []byte {
+	regs := llb.dense()
+	data := make([]byte, CompactHeaderSize, CompactHeaderSize+len(llb.hashID)+len(regs)+4)
+	copy(data[0:4], compactMagic[:])
+	data[4] = compactVersion
+	data[5] = llb.p
+	data[6] = compactChecksum
+	data[7] = uint8(len(llb.hashID))
+	data = append(data, llb.hashID...)
+	if rle {
+		data[6] |= compactRLE
+		for i := 0; i < len(regs); {
+			j := i + 1
+			for j < len(regs) && regs[j] == regs[i] {
+				j++
+			}
+			data = binary.AppendUvarint(data, uint64(j-i))
+			data = append(data, regs[i])
+			i = j
+		}
+	} else {
+		data = append(data, regs...)
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// smallestCompact returns the smaller of the two compact encodings of llb.
+// Run-length encoding wins until the sketch is well filled.
+func (llb *LogLogBeta) smallestCompact() []byte {
+	data := llb.marshalCompact(true)
+	if len(data) > CompactHeaderSize+len(llb.hashID)+llb.numRegisters()+4 {
+		data = llb.marshalCompact(false)
+	}
+	return data
+}
+
+// UnmarshalCompact decodes a sketch written by MarshalCompact,
+// MarshalCompactRLE or another implementation of the same layout. Blobs
+// without a checksum are accepted.
+// The registers are copied, so data may be reused afterwards. As with
+// UnmarshalBinary, a zero LogLogBeta takes on the precision and hash of data
+// while any other sketch only accepts its own. Version 1 blobs don't record
+// their hash and are accepted by any sketch of their precision.
+func (llb *LogLogBeta) UnmarshalCompact(data []byte) error {
+	d, err := llb.decodeCompact(data)
+	if err != nil {
+		return err
+	}
+	if d.hasHash {
+		if err := llb.adoptHash(d.hashID); err != nil {
+			return err
+		}
+	}
+	if err := llb.load(d.p, d.regs); err != nil {
+		return err
+	}
+	llb.alpha = alpha(float64(llb.numRegisters()))
+	return nil
+}
+
+// decodeCompact validates a compact blob without changing llb, checking only
+// that llb accepts its precision. The registers may alias data.
+func (llb *LogLogBeta) decodeCompact(data []byte) (decoded, error) {
+	if len(data) < CompactHeaderSize {
+		return decoded{}, errCompactShort
+	}
+	if [4]byte{data[0], data[1], data[2], data[3]} != compactMagic {
+		return decoded{}, errCompactMagic
+	}
+	v := data[4]
+	if v != 1 && v != compactVersion {
+		return decoded{}, &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(v), Want: compactVersion}
+	}
+	p := data[5]
+	if err := llb.acceptPrecision(p); err != nil {
+		return decoded{}, err
+	}
+	flags := data[6]
+	if flags&^(compactChecksum|compactRLE) != 0 || v == 1 && data[7] != 0 {
+		return decoded{}, errCompactFlags
+	}
+	start := CompactHeaderSize + int(data[7])
+	if len(data) < start {
+		return decoded{}, errCompactShort
+	}
+
+	var regs []uint8
+	end := start + 1<<p
+	if flags&compactRLE != 0 {
+		var err error
+		if regs, end, err = decodeRuns(data, start, 1<<p); err != nil {
+			return decoded{}, err
+		}
+	} else if len(data) >= end {
+		regs = data[start:end]
+	}
+	size := end
+	if flags&compactChecksum != 0 {
+		size += 4
+	}
+	if len(data) < size {
+		return decoded{}, errCompactShort
+	}
+	if flags&compactChecksum != 0 && crc32.ChecksumIEEE(data[:end]) != binary.BigEndian.Uint32(data[end:]) {
+		return decoded{}, ErrChecksumMismatch
+	}
+	return decoded{
+		p:       p,
+		regs:    regs,
+		hashID:  storedID(string(data[CompactHeaderSize:start])),
+		hasHash: v > 1,
+	}, nil
+}
+
+// decodeRuns expands the run-length encoded registers starting at offset
+// off in data into n registers. It returns them and the offset just past
+// the last run.
+func decodeRuns(data []byte, off, n int) ([]uint8, int, error) {
+	regs := make([]uint8, 0, n)
+	for len(regs) < n {
+		count, k := binary.Uvarint(data[off:])
+		if k == 0 || off+k >= len(data) {
+			return nil, 0, errCompactShort
+		}
+		if k < 0 || count == 0 || count > uint64(n-len(regs)) {
+			return nil, 0, errCompactRuns
+		}
+		v := data[off+k]
+		for i := uint64(0); i < count; i++ {
+			regs = append(regs, v)
+		}
+		off += k + 1
+	}
+	return regs, off, nil
+}
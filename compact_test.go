@@ -0,0 +1,242 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestCompactGolden(t *testing.T) {
+	data, err := buildRange(0, 1000).MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", "compact-v2.golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, golden) {
+		t.Fatal("compact encoding differs from the golden file; the format must not change without a version bump")
+	}
+
+	hdr := []byte{'L', 'L', 'B', 'C', compactVersion, precision, compactChecksum, 0}
+	if !bytes.Equal(golden[:CompactHeaderSize], hdr) {
+		t.Errorf("unexpected header % x", golden[:CompactHeaderSize])
+	}
+	if len(golden) != CompactHeaderSize+int(m)+4 {
+		t.Errorf("unexpected length %d", len(golden))
+	}
+}
+
+func TestCompactRLEGolden(t *testing.T) {
+	data, err := buildRange(0, 1000).MarshalCompactRLE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", "compact-rle-v2.golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, golden) {
+		t.Fatal("run-length compact encoding differs from the golden file; the format must not change without a version bump")
+	}
+	if golden[6] != compactChecksum|compactRLE || len(golden) >= int(m)/2 {
+		t.Errorf("unexpected flags %#x or length %d", golden[6], len(golden))
+	}
+}
+
+// Version 1 blobs, written before the hash id was recorded, still decode
+// into any sketch of their precision.
+func TestCompactV1(t *testing.T) {
+	exp := buildRange(0, 1000)
+	for _, name := range []string{"compact-v1.golden", "compact-rle-v1.golden"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, got := range []*LogLogBeta{{}, New(), New(WithHasherXXHash())} {
+			if err := got.UnmarshalCompact(data); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !bytes.Equal(got.registers, exp.registers) {
+				t.Errorf("%s: decoded registers differ", name)
+			}
+		}
+	}
+}
+
+func TestCompactHashID(t *testing.T) {
+	llb := buildRange(0, 1000)
+	llb.hash, llb.hashID = xxhash.Sum64, "xxhash"
+	for _, marshal := range []func() ([]byte, error){llb.MarshalCompact, llb.MarshalCompactRLE} {
+		data, err := marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[7] != 6 || string(data[CompactHeaderSize:CompactHeaderSize+6]) != "xxhash" {
+			t.Errorf("unexpected hash id % x", data[7:CompactHeaderSize+6])
+		}
+		if err := New().UnmarshalCompact(data); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("expected a default sketch to refuse an xxhash blob, got %v", err)
+		}
+		if err := New().UnmarshalBinary(data); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("expected UnmarshalBinary to refuse an xxhash blob, got %v", err)
+		}
+		var zero LogLogBeta
+		if err := zero.UnmarshalCompact(data); err != nil || zero.HashID() != "xxhash" {
+			t.Errorf("zero sketch: %v, hash %q", err, zero.HashID())
+		}
+		if !bytes.Equal(zero.registers, llb.registers) {
+			t.Error("decoded registers differ")
+		}
+		same := New(WithHasherXXHash())
+		if err := same.UnmarshalCompact(data); err != nil {
+			t.Errorf("same hash: %v", err)
+		}
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	llb := buildRange(0, 50000)
+	data, err := llb.MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := New(WithPackedRegisters())
+	if err := got.UnmarshalCompact(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.registers, llb.registers) || got.Cardinality() != llb.Cardinality() {
+		t.Error("decoded sketch differs from the original")
+	}
+	checkHist(t, "UnmarshalCompact", got)
+
+	// Other writers may leave the checksum out.
+	bare := append([]byte(nil), data[:CompactHeaderSize+int(m)]...)
+	bare[6] = 0
+	if err := New().UnmarshalCompact(bare); err != nil {
+		t.Errorf("blob without checksum: %v", err)
+	}
+}
+
+func TestCompactErrors(t *testing.T) {
+	good, err := buildRange(0, 100).MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate := func(f func(b []byte)) []byte {
+		b := append([]byte(nil), good...)
+		f(b)
+		return b
+	}
+	resum := func(b []byte) {
+		end := len(b) - 4
+		binary.BigEndian.PutUint32(b[end:], crc32.ChecksumIEEE(b[:end]))
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		is   error
+	}{
+		{"short header", good[:4], errCompactShort},
+		{"short registers", good[:len(good)-5], errCompactShort},
+		{"missing checksum", good[:len(good)-1], errCompactShort},
+		{"magic", mutate(func(b []byte) { b[0] = 'X' }), errCompactMagic},
+		{"version", mutate(func(b []byte) { b[4] = 3 }), ErrVersionUnsupported},
+		{"precision", mutate(func(b []byte) { b[5] = 10 }), ErrPrecisionMismatch},
+		{"flags", mutate(func(b []byte) { b[6] |= 4; resum(b) }), errCompactFlags},
+		{"reserved", mutate(func(b []byte) { b[4], b[7] = 1, 1; resum(b) }), errCompactFlags},
+		{"hash id", mutate(func(b []byte) { b[7] = 1 }), errCompactShort},
+		{"corrupt register", mutate(func(b []byte) { b[CompactHeaderSize]++ }), ErrChecksumMismatch},
+	}
+	for _, c := range cases {
+		if err := New().UnmarshalCompact(c.data); !errors.Is(err, c.is) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.is, err)
+		}
+	}
+}
+
+func TestCompactRLE(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 200000} {
+		llb := buildRange(0, n)
+		data, err := llb.MarshalCompactRLE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got LogLogBeta
+		if err := got.UnmarshalCompact(data); err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if !bytes.Equal(got.registers, llb.registers) {
+			t.Errorf("n=%d: decoded registers differ", n)
+		}
+		checkHist(t, "UnmarshalCompact", &got)
+	}
+
+	good, err := buildRange(0, 100).MarshalCompactRLE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := good[:len(good)-4]
+	seal := func(b []byte) []byte {
+		return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+	}
+	header := append([]byte(nil), body[:CompactHeaderSize]...)
+	cases := []struct {
+		name string
+		data []byte
+		is   error
+	}{
+		{"truncated runs", body[:len(body)-3], errCompactShort},
+		{"missing checksum", good[:len(good)-2], errCompactShort},
+		{"zero run", seal(append(append([]byte(nil), header...), 0, 1)), errCompactRuns},
+		{"overlong run", seal(binary.AppendUvarint(append([]byte(nil), header...), uint64(m)+1)), errCompactRuns},
+		{"corrupt run", append(append([]byte(nil), body...), 0, 0, 0, 0), ErrChecksumMismatch},
+	}
+	for _, c := range cases {
+		if err := New().UnmarshalCompact(c.data); !errors.Is(err, c.is) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.is, err)
+		}
+	}
+}
+
+func TestUnmarshalBinaryCompact(t *testing.T) {
+	llb := buildRange(0, 5000)
+	for _, marshal := range []func() ([]byte, error){llb.MarshalCompact, llb.MarshalCompactRLE} {
+		data, err := marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := New()
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.registers, llb.registers) {
+			t.Error("UnmarshalBinary decoded a compact blob incorrectly")
+		}
+	}
+}
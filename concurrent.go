@@ -0,0 +1,106 @@
+package loglogbeta
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Concurrent is a sketch that many goroutines can add to at once without a
+// lock. Registers are packed four to a 32-bit word and raised with a
+// compare-and-swap, so concurrent inserts only contend when they hit the
+// same word at the same moment, and an insert that doesn't raise its
+// register, the common case once the sketch has filled up, is a single
+// atomic load.
+//
+// Cardinality scans the registers instead of reading maintained counts, so
+// it costs a pass over them and an allocation; it suits periodic reads
+// alongside heavy ingestion. All methods are safe for concurrent use.
+type Concurrent struct {
+	p      uint8
+	alpha  float64
+	hash   func([]byte) uint64
+	hashID string
+	// words holds register k in byte k%4 of words[k/4].
+	words []atomic.Uint32
+}
+
+// NewConcurrent returns an empty Concurrent sketch. Only the precision, hash
+// and alpha chosen by opts carry over; storage and diagnostic options such
+// as WithPackedRegisters or WithRegisterAges have no effect.
+func NewConcurrent(opts ...Option) *Concurrent {
+	tmpl := New(opts...)
+	return &Concurrent{
+		p:      tmpl.p,
+		alpha:  tmpl.alpha,
+		hash:   tmpl.hash,
+		hashID: tmpl.hashID,
+		words:  make([]atomic.Uint32, (tmpl.numRegisters()+3)/4),
+	}
+}
+
+// AddHash inserts an already hashed value into the sketch.
+func (c *Concurrent) AddHash(x uint64) {
+	k, val := getPosVal(x, c.p)
+	c.raise(k, val)
+}
+
+// Add inserts a value into the sketch.
+func (c *Concurrent) Add(value []byte) {
+	c.AddHash(c.hash(value))
+}
+
+// raise sets register k to val unless it already holds at least val.
+func (c *Concurrent) raise(k uint64, val uint8) {
+	w := &c.words[k/4]
+	shift := 8 * (k % 4)
+	for {
+		old := w.Load()
+		if uint8(old>>shift) >= val {
+			return
+		}
+		if w.CompareAndSwap(old, old&^(0xff<<shift)|uint32(val)<<shift) {
+			return
+		}
+	}
+}
+
+// Merge raises the registers of c to those of other, making c the union of
+// both. other must not be modified concurrently. If it has a different
+// precision, c is left unchanged and an *IncompatibleError wrapping
+// ErrPrecisionMismatch is returned, and likewise ErrHashMismatch if it was
+// built with a different hash.
+func (c *Concurrent) Merge(other *LogLogBeta) error {
+	if got, want := other.numRegisters(), 4*len(c.words); got != want {
+		return &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(got), Want: uint64(want)}
+	}
+	if other.hashID != c.hashID {
+		return fmt.Errorf("%w: got %q, want %q", ErrHashMismatch, hashName(other.hashID), hashName(c.hashID))
+	}
+	for k, n := uint64(0), uint64(other.numRegisters()); k < n; k++ {
+		if v := other.reg(k); v != 0 {
+			c.raise(k, v)
+		}
+	}
+	return nil
+}
+
+// Snapshot returns a regular sketch holding a copy of the registers, for
+// example to serialize them. Inserts that run concurrently with Snapshot
+// may or may not be included.
+func (c *Concurrent) Snapshot() *LogLogBeta {
+	llb := newSketch(c.p, nil)
+	llb.alpha, llb.hash, llb.hashID = c.alpha, c.hash, c.hashID
+	for i := range c.words {
+		w := c.words[i].Load()
+		for j := 0; j < 4; j++ {
+			llb.registers[4*i+j] = uint8(w >> (8 * j))
+		}
+	}
+	llb.recount()
+	return llb
+}
+
+// Cardinality returns the estimated cardinality of the sketch.
+func (c *Concurrent) Cardinality() uint64 {
+	return c.Snapshot().Cardinality()
+}
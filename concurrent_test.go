@@ -0,0 +1,86 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrent(t *testing.T) {
+	const workers, per = 8, 20000
+	c := NewConcurrent()
+	exp := New()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Overlapping ranges, so workers race on the same registers.
+			for i := w * per / 2; i < w*per/2+per; i++ {
+				c.Add([]byte(strconv.Itoa(i)))
+			}
+		}(w)
+	}
+	for i := 0; i < (workers+1)*per/2; i++ {
+		exp.Add([]byte(strconv.Itoa(i)))
+	}
+	wg.Wait()
+
+	snap := c.Snapshot()
+	if !bytes.Equal(snap.registers, exp.registers) {
+		t.Error("registers differ from a serially built sketch")
+	}
+	checkHist(t, "Snapshot", snap)
+	if c.Cardinality() != exp.Cardinality() {
+		t.Errorf("expected %d, got %d", exp.Cardinality(), c.Cardinality())
+	}
+
+	// AddHash(0) stores the largest rank, which must not leak into the
+	// neighbouring registers of the same word.
+	z := NewConcurrent()
+	z.AddHash(0)
+	if r := z.Snapshot().registers; r[0] != maxRank || r[1] != 0 {
+		t.Errorf("unexpected registers %v", r[:4])
+	}
+}
+
+func TestConcurrentMerge(t *testing.T) {
+	c := NewConcurrent()
+	for i := 0; i < 1000; i++ {
+		c.Add([]byte(strconv.Itoa(i)))
+	}
+	if err := c.Merge(buildRange(500, 3000)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Snapshot().registers, buildRange(0, 3000).registers) {
+		t.Error("merged registers differ from the union")
+	}
+
+	small, _ := NewWithPrecision(10)
+	if err := c.Merge(small); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch, got %v", err)
+	}
+}
+
+func BenchmarkConcurrentAddHash(b *testing.B) {
+	c := NewConcurrent()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			c.AddHash(rng.Uint64())
+		}
+	})
+}
+
+func BenchmarkPublishedAddHash(b *testing.B) {
+	p := NewPublishedSketch()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			p.AddHash(rng.Uint64())
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package loglogbeta
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes the sketch's registers to w as "index,value" rows preceded
+// by a header row. If nonZeroOnly is set, registers that are still zero are
+// skipped. This is a diagnostic export; use MarshalBinary for storage.
+func (llb *LogLogBeta) WriteCSV(w io.Writer, nonZeroOnly bool) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "value"}); err != nil {
+		return err
+	}
+
+	row := make([]string, 2)
+	for i, v := range llb.dense() {
+		if nonZeroOnly && v == 0 {
+			continue
+		}
+		row[0] = strconv.Itoa(i)
+		row[1] = strconv.Itoa(int(v))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,51 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	llb := New()
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for _, nonZeroOnly := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := llb.WriteCSV(&buf, nonZeroOnly); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows[0][0] != "index" || rows[0][1] != "value" {
+			t.Errorf("unexpected header %v", rows[0])
+		}
+
+		seen := 0
+		for _, row := range rows[1:] {
+			i, _ := strconv.Atoi(row[0])
+			v, _ := strconv.Atoi(row[1])
+			if uint8(v) != llb.registers[i] {
+				t.Errorf("register %d: expected %d, got %d", i, llb.registers[i], v)
+			}
+			if nonZeroOnly && v == 0 {
+				t.Errorf("register %d: zero value written with nonZeroOnly", i)
+			}
+			seen++
+		}
+
+		exp := len(llb.registers)
+		if nonZeroOnly {
+			_, ez := regSumAndZeros(llb.registers)
+			exp -= int(ez)
+		}
+		if seen != exp {
+			t.Errorf("nonZeroOnly=%v: expected %d rows, got %d", nonZeroOnly, exp, seen)
+		}
+	}
+}
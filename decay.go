@@ -0,0 +1,38 @@
+package loglogbeta
+
+import "math/rand"
+
+// DecayMerge is an experimental, stochastic variant of Merge for
+// recency-weighted counts. Each register increase that other would bring is
+// adopted only with probability weight, so merging an older sketch with a
+// small weight contributes only part of its elements. weight is clamped to
+// [0, 1]; 1 behaves like Merge and 0 leaves llb unchanged.
+//
+// The result is a weighted approximation, not the cardinality of any actual
+// set, and the usual error bounds don't apply to it. rng drives the random
+// choices so runs can be reproduced; if it is nil the shared source of the
+// math/rand package is used, which is safe for concurrent use and gives
+// each call its own choices. Like Merge, it returns an error and leaves llb unchanged if the
+// precisions differ.
+func (llb *LogLogBeta) DecayMerge(other *LogLogBeta, weight float64, rng *rand.Rand) error {
+	if err := llb.checkMergeable(other); err != nil {
+		return err
+	}
+	if !(weight > 0) {
+		return nil
+	}
+	if weight >= 1 {
+		return llb.Merge(other)
+	}
+	draw := rand.Float64
+	if rng != nil {
+		draw = rng.Float64
+	}
+
+	for i, n := uint64(0), uint64(llb.numRegisters()); i < n; i++ {
+		if v := other.reg(i); llb.reg(i) < v && draw() < weight {
+			llb.setRegister(i, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDecayMerge(t *testing.T) {
+	recent := buildRange(0, 100000)
+	old := buildRange(100000, 200000)
+
+	full := recent.Clone()
+	full.DecayMerge(old, 1, nil)
+	if exp := recent.Plus(old); !bytes.Equal(full.registers, exp.registers) {
+		t.Error("weight 1 should behave like Merge")
+	}
+
+	none := recent.Clone()
+	none.DecayMerge(old, 0, nil)
+	none.DecayMerge(old, -3, nil)
+	if !bytes.Equal(none.registers, recent.registers) {
+		t.Error("weight 0 should leave the sketch unchanged")
+	}
+
+	// With weight w the result lands between the two extremes, closer to
+	// the undecayed sketch for small w.
+	prev := recent.Cardinality()
+	for _, w := range []float64{0.1, 0.5, 0.9} {
+		d := recent.Clone()
+		d.DecayMerge(old, w, rand.New(rand.NewSource(42)))
+		checkHist(t, "DecayMerge", d)
+		got := d.Cardinality()
+		if got <= prev || got >= full.Cardinality() {
+			t.Errorf("weight %v: expected between %d and %d, got %d", w, prev, full.Cardinality(), got)
+		}
+		prev = got
+	}
+
+	a, b := recent.Clone(), recent.Clone()
+	a.DecayMerge(old, 0.3, rand.New(rand.NewSource(7)))
+	b.DecayMerge(old, 0.3, rand.New(rand.NewSource(7)))
+	if !bytes.Equal(a.registers, b.registers) {
+		t.Error("same seed produced different results")
+	}
+
+	// Without an rng, repeated decays make their own choices.
+	a, b = recent.Clone(), recent.Clone()
+	a.DecayMerge(old, 0.5, nil)
+	b.DecayMerge(old, 0.5, nil)
+	if bytes.Equal(a.registers, b.registers) {
+		t.Error("decays without an rng made the same choices")
+	}
+}
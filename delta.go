@@ -0,0 +1,21 @@
+package loglogbeta
+
+// CardinalityDelta returns how much the estimate has grown since the
+// previous call, or since the sketch was created or reset for the first
+// call, giving an approximate count of new distinct elements per interval.
+//
+// The estimate can dip slightly as registers change, so a decrease is
+// reported as 0 and the next rise is only counted once it passes the highest
+// estimate seen before. The deltas therefore add up to the largest estimate
+// reported so far. Deltas much smaller than EstimatedError times the
+// cardinality are within the estimate's noise and shouldn't be read as real
+// growth.
+func (llb *LogLogBeta) CardinalityDelta() uint64 {
+	c := llb.Cardinality()
+	if c <= llb.reported {
+		return 0
+	}
+	d := c - llb.reported
+	llb.reported = c
+	return d
+}
@@ -0,0 +1,161 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// deltaVersion is the version MarshalDeltaFrom writes. Version 1 deltas,
+// which don't record the hash, are still read.
+const deltaVersion = 2
+
+var deltaMagic = [4]byte{'L', 'L', 'B', 'D'}
+
+var errDeltaCorrupt = errors.New("loglogbeta: corrupt register delta")
+
+// RegisterDelta is a register raised to a new value, as listed by Diff.
+type RegisterDelta struct {
+	Index uint32
+	Value uint8
+}
+
+// Diff lists, in index order, the registers in which llb exceeds since,
+// with their values in llb. Registers only grow, so applying the list to a
+// copy of since with ApplyDiff reproduces llb exactly, and a checkpoint or
+// replica that holds since only needs the list to catch up.
+//
+// A cheap way to keep since is a LazyClone taken at the last checkpoint:
+// reading it costs nothing, and llb copies its registers once on the next
+// write. Diff returns an *IncompatibleError wrapping ErrPrecisionMismatch if
+// the precisions differ and an error wrapping ErrHashMismatch if the
+// sketches were built with different hashes, whose registers don't compare.
+func (llb *LogLogBeta) Diff(since *LogLogBeta) ([]RegisterDelta, error) {
+	if err := llb.checkMergeable(since); err != nil {
+		return nil, err
+	}
+	var deltas []RegisterDelta
+	for i, n := uint64(0), uint64(llb.numRegisters()); i < n; i++ {
+		if v := llb.reg(i); v > since.reg(i) {
+			deltas = append(deltas, RegisterDelta{Index: uint32(i), Value: v})
+		}
+	}
+	return deltas, nil
+}
+
+// ApplyDiff raises each listed register to its value, as produced by Diff.
+// Applied to the sketch the list was computed against, this reproduces the
+// sketch it was computed from; applied to any other sketch it merges in the
+// changed registers. The list is validated before any register is changed:
+// an index out of range or a value above the largest possible rank is an
+// error and leaves llb unchanged.
+func (llb *LogLogBeta) ApplyDiff(deltas []RegisterDelta) error {
+	for _, d := range deltas {
+		if int(d.Index) >= llb.numRegisters() || int(d.Value) > llb.rankCap() {
+			return fmt.Errorf("loglogbeta: invalid register delta %d=%d", d.Index, d.Value)
+		}
+	}
+	for _, d := range deltas {
+		if k := uint64(d.Index); llb.reg(k) < d.Value {
+			llb.setRegister(k, d.Value)
+		}
+	}
+	return nil
+}
+
+// MarshalDeltaFrom encodes the registers in which llb exceeds baseline, for
+// replicating a sketch that has changed little since baseline was shipped.
+// The layout is the magic "LLBD", a version byte, the precision, the length
+// of the hash id and the id as HashID returns it, empty for the default
+// metro hash, a varint count of changed registers, then for each in index
+// order the varint distance from the previous changed index and the new
+// value, and finally a big-endian CRC-32 (IEEE) of everything before it.
+// Registers only grow, so applying the delta to a copy of baseline with
+// UnmarshalDeltaInto reproduces llb exactly.
+func (llb *LogLogBeta) MarshalDeltaFrom(baseline *LogLogBeta) ([]byte, error) {
+	deltas, err := llb.Diff(baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	data := append([]byte(nil), deltaMagic[:]...)
+	data = append(data, deltaVersion, llb.p, uint8(len(llb.hashID)))
+	data = append(data, llb.hashID...)
+	data = binary.AppendUvarint(data, uint64(len(deltas)))
+	prev := uint32(0)
+	for _, d := range deltas {
+		data = binary.AppendUvarint(data, uint64(d.Index-prev))
+		data = append(data, d.Value)
+		prev = d.Index
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalDeltaInto applies a delta written by MarshalDeltaFrom to llb,
+// raising each listed register to its new value. Applied to the baseline it
+// was computed against, this reproduces the sketch it was computed from;
+// applied to any other sketch it merges in the changed registers. The delta
+// is fully validated before any register is changed, and must have been
+// computed from a sketch of llb's precision and hash; version 1 deltas don't
+// record the hash, so only their precision is checked.
+func (llb *LogLogBeta) UnmarshalDeltaInto(data []byte) error {
+	if len(data) < 6+4 {
+		return errDeltaCorrupt
+	}
+	if [4]byte{data[0], data[1], data[2], data[3]} != deltaMagic {
+		return errDeltaCorrupt
+	}
+	v := data[4]
+	if v != 1 && v != deltaVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(v), Want: deltaVersion}
+	}
+	if data[5] != llb.p {
+		return &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(data[5]), Want: uint64(llb.p)}
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return ErrChecksumMismatch
+	}
+
+	rest := body[6:]
+	if v > 1 {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return errDeltaCorrupt
+		}
+		n := int(rest[0])
+		if err := llb.checkHash(storedID(string(rest[1 : 1+n]))); err != nil {
+			return err
+		}
+		rest = rest[1+n:]
+	}
+	count, n := binary.Uvarint(rest)
+	if n <= 0 || count > uint64(llb.numRegisters()) {
+		return errDeltaCorrupt
+	}
+	rest = rest[n:]
+
+	// Decode twice: first to validate, then to apply.
+	for pass := 0; pass < 2; pass++ {
+		r, k := rest, uint64(0)
+		for i := uint64(0); i < count; i++ {
+			d, n := binary.Uvarint(r)
+			if n <= 0 || n >= len(r) || (i > 0 && d == 0) {
+				return errDeltaCorrupt
+			}
+			k += d
+			v := r[n]
+			r = r[n+1:]
+			if k >= uint64(llb.numRegisters()) || v == 0 || int(v) > llb.rankCap() {
+				return errDeltaCorrupt
+			}
+			if pass == 1 && llb.reg(k) < v {
+				llb.setRegister(k, v)
+			}
+		}
+		if len(r) != 0 {
+			return errDeltaCorrupt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestMarshalDelta(t *testing.T) {
+	baseline := buildRange(0, 50000)
+	cur := baseline.Plus(buildRange(50000, 50100))
+
+	data, err := cur.MarshalDeltaFrom(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, _ := cur.MarshalBinary()
+	if len(data)*20 > len(full) {
+		t.Errorf("delta of %d bytes is not much smaller than the %d byte blob", len(data), len(full))
+	}
+
+	replica := baseline.Clone()
+	if err := replica.UnmarshalDeltaInto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replica.registers, cur.registers) {
+		t.Error("applying the delta didn't reproduce the sketch")
+	}
+	checkHist(t, "UnmarshalDeltaInto", replica)
+
+	// An empty delta, and a delta including register 0 and the last one.
+	empty, err := cur.MarshalDeltaFrom(cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.UnmarshalDeltaInto(empty); err != nil || !bytes.Equal(replica.registers, cur.registers) {
+		t.Errorf("empty delta changed the sketch or failed: %v", err)
+	}
+	edges := New()
+	edges.AddHash(0)
+	edges.AddHash(^uint64(0))
+	data, _ = edges.MarshalDeltaFrom(New())
+	got := New()
+	if err := got.UnmarshalDeltaInto(data); err != nil || !bytes.Equal(got.registers, edges.registers) {
+		t.Errorf("edge registers: %v", err)
+	}
+
+	if _, err := cur.MarshalDeltaFrom(New(WithPackedRegisters())); err != nil {
+		t.Errorf("packed baseline: %v", err)
+	}
+
+	// The delta records the hash, so it only applies to sketches built
+	// with the same one.
+	xx := New(WithHasherXXHash())
+	xx.Add([]byte("x"))
+	data, _ = xx.MarshalDeltaFrom(New(WithHasherXXHash()))
+	if err := New().UnmarshalDeltaInto(data); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	got = New(WithHasherXXHash())
+	if err := got.UnmarshalDeltaInto(data); err != nil || !bytes.Equal(got.registers, xx.registers) {
+		t.Errorf("same hash: %v", err)
+	}
+
+	// Version 1 deltas have no hash id.
+	v1 := append([]byte{'L', 'L', 'B', 'D', 1, precision}, data[7+len("xxhash"):len(data)-4]...)
+	v1 = binary.BigEndian.AppendUint32(v1, crc32.ChecksumIEEE(v1))
+	got = New()
+	if err := got.UnmarshalDeltaInto(v1); err != nil || !bytes.Equal(got.registers, xx.registers) {
+		t.Errorf("version 1: %v", err)
+	}
+}
+
+func TestUnmarshalDeltaErrors(t *testing.T) {
+	cur := buildRange(0, 100)
+	good, _ := cur.MarshalDeltaFrom(New())
+	mutate := func(f func(b []byte) []byte) []byte {
+		b := f(append([]byte(nil), good...))
+		body := b[:len(b)-4]
+		binary.BigEndian.PutUint32(b[len(b)-4:], crc32.ChecksumIEEE(body))
+		return b
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		is   error
+	}{
+		{"short", good[:6], errDeltaCorrupt},
+		{"magic", mutate(func(b []byte) []byte { b[0] = 'X'; return b }), errDeltaCorrupt},
+		{"version", mutate(func(b []byte) []byte { b[4] = 9; return b }), ErrVersionUnsupported},
+		{"precision", mutate(func(b []byte) []byte { b[5] = 4; return b }), ErrPrecisionMismatch},
+		{"checksum", append(append([]byte(nil), good[:len(good)-1]...), good[len(good)-1]+1), ErrChecksumMismatch},
+		{"truncated", mutate(func(b []byte) []byte { return append(b[:len(b)-6], 0, 0, 0, 0) }), errDeltaCorrupt},
+		{"trailing", mutate(func(b []byte) []byte { return append(b[:len(b)-4], 1, 1, 0, 0, 0, 0) }), errDeltaCorrupt},
+		{"bad value", mutate(func(b []byte) []byte { b[len(b)-5] = maxRank + 1; return b }), errDeltaCorrupt},
+	}
+	for _, c := range cases {
+		llb := New()
+		if err := llb.UnmarshalDeltaInto(c.data); !errors.Is(err, c.is) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.is, err)
+		}
+		if llb.Cardinality() != 0 {
+			t.Errorf("%s: sketch changed by a rejected delta", c.name)
+		}
+	}
+
+	if _, err := cur.MarshalDeltaFrom(&LogLogBeta{registers: make([]uint8, 16)}); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch, got %v", err)
+	}
+	if _, err := cur.MarshalDeltaFrom(New(WithHasherXXHash())); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected ErrHashMismatch, got %v", err)
+	}
+}
+
+func TestDiffHash(t *testing.T) {
+	llb, xx := buildRange(0, 100), New(WithHasherXXHash())
+	if deltas, err := llb.Diff(xx); !errors.Is(err, ErrHashMismatch) || deltas != nil {
+		t.Errorf("expected ErrHashMismatch and no deltas, got %d deltas, %v", len(deltas), err)
+	}
+	if _, err := xx.Diff(New(WithHasherXXHash())); err != nil {
+		t.Errorf("same hash: %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	baseline := buildRange(0, 50000)
+	checkpoint := baseline.LazyClone()
+	for i := 50000; i < 50100; i++ {
+		baseline.Add([]byte(strconv.Itoa(i)))
+	}
+
+	deltas, err := baseline.Diff(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) == 0 || len(deltas) > 100 {
+		t.Fatalf("expected at most 100 changed registers, got %d", len(deltas))
+	}
+	for i, d := range deltas {
+		if i > 0 && d.Index <= deltas[i-1].Index {
+			t.Fatal("deltas are not in index order")
+		}
+		if d.Value != baseline.registers[d.Index] || d.Value <= checkpoint.registers[d.Index] {
+			t.Errorf("unexpected delta %+v", d)
+		}
+	}
+
+	replica := checkpoint.Clone()
+	if err := replica.ApplyDiff(deltas); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replica.registers, baseline.registers) {
+		t.Error("applying the diff didn't reproduce the sketch")
+	}
+	checkHist(t, "ApplyDiff", replica)
+	if deltas, _ := baseline.Diff(replica); len(deltas) != 0 {
+		t.Errorf("expected no diff after catching up, got %d", len(deltas))
+	}
+
+	// Applying to a sketch ahead of the list never lowers a register.
+	ahead := baseline.Plus(buildRange(100000, 200000))
+	before := append([]uint8(nil), ahead.registers...)
+	if err := ahead.ApplyDiff(deltas); err != nil || !bytes.Equal(ahead.registers, before) {
+		t.Errorf("ApplyDiff lowered registers or failed: %v", err)
+	}
+
+	sparse := New(WithSparseRegisters())
+	if err := sparse.ApplyDiff([]RegisterDelta{{Index: 3, Value: 7}}); err != nil || sparse.reg(3) != 7 || !sparse.sparse {
+		t.Errorf("sparse: got register %d, %v", sparse.reg(3), err)
+	}
+
+	for _, bad := range [][]RegisterDelta{
+		{{Index: 1, Value: 2}, {Index: uint32(m), Value: 1}},
+		{{Index: 1, Value: 2}, {Index: 2, Value: 52}},
+	} {
+		llb := New()
+		if err := llb.ApplyDiff(bad); err == nil || llb.reg(1) != 0 {
+			t.Errorf("%v: expected an error and no change, got %v", bad, err)
+		}
+	}
+	p10, _ := NewWithPrecision(10)
+	if _, err := baseline.Diff(p10); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package loglogbeta
+
+import "testing"
+
+func TestCardinalityDelta(t *testing.T) {
+	llb := New()
+	if d := llb.CardinalityDelta(); d != 0 {
+		t.Errorf("empty: expected 0, got %d", d)
+	}
+
+	exp := buildRange(0, 1000)
+	llb.Merge(exp)
+	if d := llb.CardinalityDelta(); d != exp.Cardinality() {
+		t.Errorf("expected %d, got %d", exp.Cardinality(), d)
+	}
+	if d := llb.CardinalityDelta(); d != 0 {
+		t.Errorf("no change: expected 0, got %d", d)
+	}
+
+	llb.Merge(buildRange(1000, 3000))
+	total := exp.Cardinality() + llb.CardinalityDelta()
+	if total != llb.Cardinality() {
+		t.Errorf("deltas add up to %d, expected %d", total, llb.Cardinality())
+	}
+
+	// A lower estimate, here forced through alpha, reports no growth.
+	llb.alpha /= 2
+	if d := llb.CardinalityDelta(); d != 0 {
+		t.Errorf("decrease: expected 0, got %d", d)
+	}
+
+	llb.Reset()
+	llb.alpha *= 2
+	llb.Merge(exp)
+	if d := llb.CardinalityDelta(); d != exp.Cardinality() {
+		t.Errorf("after reset: expected %d, got %d", exp.Cardinality(), d)
+	}
+}
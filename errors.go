@@ -0,0 +1,50 @@
+package loglogbeta
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned (wrapped in an *IncompatibleError) when sketches
+// or serialized blobs can't be combined. Use errors.Is to branch on them.
+var (
+	ErrPrecisionMismatch  = errors.New("loglogbeta: precision mismatch")
+	ErrSeedMismatch       = errors.New("loglogbeta: seed mismatch")
+	ErrVersionUnsupported = errors.New("loglogbeta: unsupported version")
+)
+
+// ErrInvalidPrecision is returned, wrapped, for a precision outside
+// [MinPrecision, MaxPrecision].
+var ErrInvalidPrecision = errors.New("loglogbeta: invalid precision")
+
+// ErrHashMismatch is returned, wrapped, when sketches or blobs built with
+// different hashes are combined.
+var ErrHashMismatch = errors.New("loglogbeta: hash mismatch")
+
+// ErrUnknownHash is returned, wrapped, when a blob is decoded into a zero
+// LogLogBeta but names a hash passed to WithHasher, which this package can't
+// restore by itself. Decode such blobs into a sketch created WithHasher with
+// the same id instead.
+var ErrUnknownHash = errors.New("loglogbeta: unknown hash")
+
+// ErrChecksumMismatch is returned when a serialized sketch fails its integrity
+// check, which usually means the blob was corrupted in storage or transit.
+var ErrChecksumMismatch = errors.New("loglogbeta: checksum mismatch")
+
+// IncompatibleError describes why two sketches, or a sketch and a serialized
+// blob, are incompatible. Err is one of the sentinel errors above and Got and
+// Want hold the offending values.
+type IncompatibleError struct {
+	Err  error
+	Got  uint64
+	Want uint64
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("%v: got %d, want %d", e.Err, e.Got, e.Want)
+}
+
+// Unwrap returns the sentinel error so errors.Is works on an IncompatibleError.
+func (e *IncompatibleError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,108 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// FixedHeaderSize is the number of bytes preceding the hash id and the
+// registers in the fixed-size encoding.
+const FixedHeaderSize = 12
+
+// fixedVersion is the version MarshalFixed writes. Version 1 encodings,
+// which don't record the hash, are still read.
+const fixedVersion = 2
+
+var fixedMagic = [4]byte{'L', 'L', 'B', 'F'}
+
+var (
+	errFixedShort = errors.New("loglogbeta: buffer too small for fixed encoding")
+	errFixedMagic = errors.New("loglogbeta: not a fixed encoding")
+)
+
+// FixedSize returns the number of bytes MarshalFixed writes. It depends only
+// on the precision and the hash, so every sketch built the same way
+// occupies the same number of bytes and a file of fixed-size slots can be
+// indexed by offset.
+func (llb *LogLogBeta) FixedSize() int {
+	return FixedHeaderSize + len(llb.hashID) + llb.numRegisters()
+}
+
+// MarshalFixed writes the fixed-size encoding of llb into the first
+// FixedSize bytes of dst. The layout is:
+//
+//	offset  size  field
+//	0       4     magic "LLBF"
+//	4       1     format version (2)
+//	5       1     precision p
+//	6       1     length n of the hash id
+//	7       1     reserved, zero
+//	8       4     CRC-32 (IEEE) of the hash id and registers, big-endian
+//	12      n     hash id as HashID returns it, empty for the default metro
+//	              hash
+//	12+n    2^p   registers, one byte each
+//
+// Alpha is not stored; it is recomputed from the precision when decoding.
+// Version 1 has no hash id: byte 6 is reserved and the checksum covers the
+// registers alone.
+func (llb *LogLogBeta) MarshalFixed(dst []byte) error {
+	if len(dst) < llb.FixedSize() {
+		return errFixedShort
+	}
+	copy(dst[0:4], fixedMagic[:])
+	dst[4] = fixedVersion
+	dst[5] = llb.p
+	dst[6], dst[7] = uint8(len(llb.hashID)), 0
+	body := dst[FixedHeaderSize:llb.FixedSize()]
+	copy(body, llb.hashID)
+	copy(body[len(llb.hashID):], llb.dense())
+	binary.BigEndian.PutUint32(dst[8:12], crc32.ChecksumIEEE(body))
+	return nil
+}
+
+// UnmarshalFixed decodes a sketch written by MarshalFixed from the start of
+// src. The registers are copied, so src may be reused afterwards. As with
+// UnmarshalBinary, a zero LogLogBeta takes on the precision and hash of src
+// while any other sketch only accepts its own. Version 1 encodings don't
+// record their hash and are accepted by any sketch of their precision.
+func (llb *LogLogBeta) UnmarshalFixed(src []byte) error {
+	if len(src) < FixedHeaderSize {
+		return errFixedShort
+	}
+	if [4]byte{src[0], src[1], src[2], src[3]} != fixedMagic {
+		return errFixedMagic
+	}
+	v := src[4]
+	if v != 1 && v != fixedVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(v), Want: fixedVersion}
+	}
+	p := src[5]
+	if err := llb.acceptPrecision(p); err != nil {
+		return err
+	}
+	n := 0
+	if v > 1 {
+		n = int(src[6])
+	}
+	end := FixedHeaderSize + n + 1<<p
+	if len(src) < end {
+		return errFixedShort
+	}
+
+	body := src[FixedHeaderSize:end]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(src[8:12]) {
+		return ErrChecksumMismatch
+	}
+	regs := body[n:]
+	if v > 1 {
+		if err := llb.adoptHash(storedID(string(body[:n]))); err != nil {
+			return err
+		}
+	}
+	if err := llb.load(p, regs); err != nil {
+		return err
+	}
+	llb.alpha = alpha(float64(len(regs)))
+	return nil
+}
@@ -0,0 +1,115 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestFixedRoundTrip(t *testing.T) {
+	llb := buildRange(0, 30000)
+	if llb.FixedSize() != FixedHeaderSize+int(m) {
+		t.Fatalf("unexpected FixedSize %d", llb.FixedSize())
+	}
+
+	// Pack three sketches into one buffer and read the middle one back by
+	// offset, as an mmap'd file of slots would be used.
+	size := llb.FixedSize()
+	buf := make([]byte, 3*size)
+	for i, s := range []*LogLogBeta{New(), llb, buildRange(0, 10)} {
+		if err := s.MarshalFixed(buf[i*size:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(buf[size:size+4]) != "LLBF" || buf[size+4] != fixedVersion || buf[size+5] != precision {
+		t.Errorf("unexpected header % x", buf[size:size+FixedHeaderSize])
+	}
+
+	var got LogLogBeta
+	if err := got.UnmarshalFixed(buf[size:]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.registers, llb.registers) || got.Cardinality() != llb.Cardinality() {
+		t.Error("decoded sketch differs from the original")
+	}
+	buf[size+FixedHeaderSize]++
+	if got.registers[0] != llb.registers[0] {
+		t.Error("UnmarshalFixed did not copy the registers")
+	}
+}
+
+func TestFixedErrors(t *testing.T) {
+	llb := buildRange(0, 100)
+	if err := llb.MarshalFixed(make([]byte, llb.FixedSize()-1)); err == nil {
+		t.Error("expected error for short destination")
+	}
+
+	good := make([]byte, llb.FixedSize())
+	if err := llb.MarshalFixed(good); err != nil {
+		t.Fatal(err)
+	}
+	mutate := func(f func(b []byte)) []byte {
+		b := append([]byte(nil), good...)
+		f(b)
+		return b
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		is   error
+	}{
+		{"short header", good[:FixedHeaderSize-1], nil},
+		{"short registers", good[:len(good)-1], nil},
+		{"bad magic", mutate(func(b []byte) { b[0] = 'X' }), nil},
+		{"version", mutate(func(b []byte) { b[4] = 9 }), ErrVersionUnsupported},
+		{"precision", mutate(func(b []byte) { b[5] = 10 }), ErrPrecisionMismatch},
+		{"checksum", mutate(func(b []byte) { b[FixedHeaderSize+7]++ }), ErrChecksumMismatch},
+	}
+	for _, c := range cases {
+		err := New().UnmarshalFixed(c.data)
+		if err == nil {
+			t.Errorf("%s: expected error", c.name)
+		} else if c.is != nil && !errors.Is(err, c.is) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.is, err)
+		}
+	}
+}
+
+func TestFixedHashID(t *testing.T) {
+	llb := New(WithHasherXXHash())
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+	if llb.FixedSize() != FixedHeaderSize+len("xxhash")+int(m) {
+		t.Fatalf("unexpected FixedSize %d", llb.FixedSize())
+	}
+	buf := make([]byte, llb.FixedSize())
+	if err := llb.MarshalFixed(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := New().UnmarshalFixed(buf); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a default sketch to refuse an xxhash encoding, got %v", err)
+	}
+	var got LogLogBeta
+	if err := got.UnmarshalFixed(buf); err != nil || got.HashID() != "xxhash" {
+		t.Fatalf("zero sketch: %v, hash %q", err, got.HashID())
+	}
+	if !bytes.Equal(got.registers, llb.registers) {
+		t.Error("decoded registers differ")
+	}
+
+	// Version 1 has no hash id and its checksum covers the registers only.
+	v1 := make([]byte, FixedHeaderSize+int(m))
+	copy(v1, "LLBF")
+	v1[4], v1[5] = 1, precision
+	copy(v1[FixedHeaderSize:], llb.registers)
+	binary.BigEndian.PutUint32(v1[8:12], crc32.ChecksumIEEE(llb.registers))
+	old := New()
+	if err := old.UnmarshalFixed(v1); err != nil || !bytes.Equal(old.registers, llb.registers) {
+		t.Errorf("version 1: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package loglogbeta
+
+import "math/bits"
+
+// foldRegister maps register k of a sketch of precision p+d, holding a
+// nonzero value v, to the register and value it becomes at precision p. The
+// hashes counted in register k share its low d bits, which move from the
+// index into the rank: the rank is their leading zeros plus one when they
+// aren't all zero and v+d otherwise. The result is exactly what the hashes
+// would have set at precision p, never above its cap of 64-p+1.
+func foldRegister(k uint64, v, d uint8) (uint64, uint8) {
+	if low := k & (1<<d - 1); low != 0 {
+		return k >> d, d - uint8(bits.Len64(low)) + 1
+	}
+	return k >> d, v + d
+}
+
+// absorbFolded merges high, whose precision must be at least llb's, into
+// llb register by register, folding each one down with foldRegister as it
+// goes, and merges its metadata as Merge does. The hashes must match; see
+// AbsorbHigher.
+func (llb *LogLogBeta) absorbFolded(high *LogLogBeta) {
+	d := high.p - llb.p
+	for k, n := uint64(0), uint64(high.numRegisters()); k < n; k++ {
+		v := high.reg(k)
+		if v == 0 {
+			continue
+		}
+		if j, w := foldRegister(k, v, d); llb.reg(j) < w {
+			llb.setRegister(j, w)
+		}
+	}
+	llb.mergeMetadata(high)
+}
+
+// AbsorbHigher merges high, a sketch of the same or a higher precision, into
+// llb, folding each of high's registers down to llb's precision as it goes.
+// No intermediate sketch is built, and the result is register for register
+// what llb would hold had every element of high been added to it, so a
+// coarse aggregate can take in finer sketches directly. Metadata is merged
+// as by Merge. It returns an *IncompatibleError wrapping
+// ErrPrecisionMismatch and leaves llb unchanged if high's precision is lower
+// than llb's, and an error wrapping ErrHashMismatch if it was built with a
+// different hash.
+func (llb *LogLogBeta) AbsorbHigher(high *LogLogBeta) error {
+	if high.p < llb.p {
+		return &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(high.p), Want: uint64(llb.p)}
+	}
+	if err := llb.checkHash(high.hashID); err != nil {
+		return err
+	}
+	llb.absorbFolded(high)
+	return nil
+}
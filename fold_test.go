@@ -0,0 +1,134 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestAbsorbHigher(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	hashes := []uint64{0, 1, ^uint64(0), 1 << 63}
+	for i := 0; i < 20000; i++ {
+		hashes = append(hashes, rng.Uint64())
+	}
+
+	for _, c := range []struct {
+		low, high uint8
+		opts      []Option
+	}{
+		{10, 14, nil},
+		{14, 16, nil},
+		{4, 18, nil},
+		{12, 12, nil},
+		{10, 16, []Option{WithSparseRegisters()}},
+		{10, 16, []Option{WithPackedRegisters()}},
+	} {
+		high := New(append([]Option{WithPrecision(c.high)}, c.opts...)...)
+		exp, acc := New(WithPrecision(c.low)), New(WithPrecision(c.low))
+		for i, x := range hashes {
+			exp.AddHash(x)
+			// acc already holds two thirds of the hashes, half of them also in high.
+			if i%3 != 2 {
+				acc.AddHash(x)
+			}
+			if i%3 != 1 {
+				high.AddHash(x)
+			}
+		}
+		if err := acc.AbsorbHigher(high); err != nil {
+			t.Fatalf("%d into %d: %v", c.high, c.low, err)
+		}
+		if !bytes.Equal(acc.dense(), exp.dense()) {
+			t.Errorf("%d into %d: registers differ from adding the hashes at %d", c.high, c.low, c.low)
+		}
+		checkHist(t, "absorbed", acc)
+	}
+}
+
+func TestAbsorbHigherErrors(t *testing.T) {
+	low, high := New(WithPrecision(12)), New(WithPrecision(14))
+	low.AddHash(12345)
+	want := append([]uint8(nil), high.dense()...)
+	err := high.AbsorbHigher(low)
+	var ie *IncompatibleError
+	if !errors.As(err, &ie) || !errors.Is(err, ErrPrecisionMismatch) || ie.Got != 12 || ie.Want != 14 {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+	if !bytes.Equal(high.dense(), want) {
+		t.Error("a failed AbsorbHigher changed the registers")
+	}
+	if err := low.AbsorbHigher(New(WithPrecision(16), WithHasherXXHash())); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+}
+
+func TestAbsorbHigherAllocs(t *testing.T) {
+	acc, high := New(WithPrecision(10)), New(WithPrecision(16))
+	for i := uint64(0); i < 5000; i++ {
+		high.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if n := testing.AllocsPerRun(10, func() { acc.AbsorbHigher(high) }); n != 0 {
+		t.Errorf("expected no allocations, got %v", n)
+	}
+}
+
+// foldReference folds register k of precision high, holding v, down to low
+// the slow way: it rebuilds a hash that sets register k to v and asks
+// getPosVal where that hash lands at the lower precision.
+func foldReference(k uint64, v, high, low uint8) (uint64, uint8) {
+	x := k << (64 - high)
+	if int(v) < 64-int(high)+1 {
+		x |= 1 << (64 - int(high) - int(v))
+	}
+	return getPosVal(x, low)
+}
+
+func FuzzAbsorbHigher(f *testing.F) {
+	f.Add([]byte{}, []byte{}, uint8(8), uint8(4), uint8(0))
+	f.Add([]byte{0, 1, 2, 3}, []byte{3, 2, 1, 0}, uint8(12), uint8(10), uint8(1))
+	f.Add([]byte{61, 0, 7, 9}, []byte{255}, uint8(5), uint8(0), uint8(2))
+
+	f.Fuzz(func(t *testing.T, highRegs, lowRegs []byte, hp, lp, layout uint8) {
+		// Small precisions keep each run fast.
+		hp = MinPrecision + hp%9
+		lp = MinPrecision + lp%(hp-MinPrecision+1)
+		high, start := New(WithPrecision(hp)), New(WithPrecision(lp))
+		fillRegisters(high, highRegs)
+		fillRegisters(start, lowRegs)
+
+		opts := []Option{WithPrecision(lp)}
+		switch layout % 3 {
+		case 1:
+			opts = append(opts, WithPackedRegisters())
+		case 2:
+			opts = append(opts, WithSparseRegisters())
+		}
+		acc := New(opts...)
+		for k, v := range start.registers {
+			if v != 0 {
+				acc.setRegister(uint64(k), v)
+			}
+		}
+
+		exp := append([]uint8(nil), start.registers...)
+		for k, v := range high.registers {
+			if v == 0 {
+				continue
+			}
+			if j, w := foldReference(uint64(k), v, hp, lp); w > exp[j] {
+				exp[j] = w
+			}
+		}
+		if err := acc.AbsorbHigher(high); err != nil {
+			t.Fatal(err)
+		}
+		for j, want := range exp {
+			if got := acc.reg(uint64(j)); got != want {
+				t.Fatalf("%d into %d: register %d: expected %d, got %d", hp, lp, j, want, got)
+			}
+		}
+		checkHist(t, "absorbed", acc)
+	})
+}
@@ -0,0 +1,44 @@
+package loglogbeta
+
+import "math"
+
+// Number is the set of types CardinalityAs can return.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// CardinalityAs returns llb's cardinality estimate as a T. For integer types
+// the estimate is rounded to the nearest integer, like Cardinality, and
+// saturates at the largest value T can hold instead of overflowing. For
+// floating-point types it is the unrounded CardinalityFloat value, converted
+// to T. Cardinality remains the canonical accessor; this only saves the
+// conversion at call sites.
+func CardinalityAs[T Number](llb *LogLogBeta) T {
+	est := llb.estimate()
+	// Only floating-point types keep a fraction.
+	if half := 0.5; T(half) != 0 {
+		return T(est)
+	}
+	r := math.Round(est)
+	if max := maxInt[T](); r >= float64(max) {
+		return max
+	}
+	return T(uint64(r))
+}
+
+// maxInt returns the largest value of the integer type T, found through
+// conversions alone so that it neither allocates nor needs reflection.
+func maxInt[T Number]() T {
+	var zero T
+	if zero-1 > 0 {
+		return zero - 1
+	}
+	// A signed type of b bits is the first to see 1<<(b-1) as negative.
+	b := 8
+	for b < 64 && T(uint64(1)<<(b-1)) >= 0 {
+		b *= 2
+	}
+	return T(uint64(1)<<(b-1) - 1)
+}
@@ -0,0 +1,61 @@
+package loglogbeta
+
+import (
+	"math"
+	"testing"
+)
+
+type myCount int32
+
+func TestCardinalityAs(t *testing.T) {
+	llb := buildRange(0, 100000)
+	exp := llb.Cardinality()
+
+	if got := CardinalityAs[uint64](llb); got != exp {
+		t.Errorf("uint64: expected %d, got %d", exp, got)
+	}
+	if got := CardinalityAs[int](llb); got != int(exp) {
+		t.Errorf("int: expected %d, got %d", exp, got)
+	}
+	if got := CardinalityAs[myCount](llb); got != myCount(exp) {
+		t.Errorf("named int32: expected %d, got %d", exp, got)
+	}
+	if got := CardinalityAs[float64](llb); got != llb.CardinalityFloat() {
+		t.Errorf("float64: expected %v, got %v", llb.CardinalityFloat(), got)
+	}
+	if got := CardinalityAs[float32](llb); got != float32(llb.CardinalityFloat()) {
+		t.Errorf("float32: expected %v, got %v", float32(llb.CardinalityFloat()), got)
+	}
+
+	// Narrow types saturate instead of wrapping around.
+	if got := CardinalityAs[uint8](llb); got != math.MaxUint8 {
+		t.Errorf("uint8: expected %d, got %d", math.MaxUint8, got)
+	}
+	if got := CardinalityAs[int16](llb); got != math.MaxInt16 {
+		t.Errorf("int16: expected %d, got %d", math.MaxInt16, got)
+	}
+	if got := CardinalityAs[uint16](buildRange(0, 100)); got != 100 {
+		t.Errorf("uint16 in range: expected 100, got %d", got)
+	}
+
+	huge := buildRange(0, 10)
+	huge.alpha = math.MaxFloat64
+	if got := CardinalityAs[int64](huge); got != math.MaxInt64 {
+		t.Errorf("int64: expected %d, got %d", int64(math.MaxInt64), got)
+	}
+	if got := CardinalityAs[uint64](huge); got != math.MaxUint64 {
+		t.Errorf("uint64: expected %d, got %d", uint64(math.MaxUint64), got)
+	}
+	if got := CardinalityAs[int8](huge); got != math.MaxInt8 {
+		t.Errorf("int8: expected %d, got %d", math.MaxInt8, got)
+	}
+	if got := CardinalityAs[myCount](huge); got != math.MaxInt32 {
+		t.Errorf("myCount: expected %d, got %d", math.MaxInt32, got)
+	}
+	if got := CardinalityAs[int](New()); got != 0 {
+		t.Errorf("empty: expected 0, got %d", got)
+	}
+	if n := testing.AllocsPerRun(100, func() { CardinalityAs[int16](llb) }); n != 0 {
+		t.Errorf("expected no allocations, got %v", n)
+	}
+}
@@ -0,0 +1,90 @@
+package loglogbeta
+
+import "math"
+
+// Group runs several independently seeded sketches over the same stream, so
+// the spread of their estimates gives an empirical error bar for the data at
+// hand rather than the asymptotic 1.04/sqrt(m) figure.
+//
+// Every member sees the same elements, but member i re-hashes each hash with
+// its own seed before adding it, so the members fill their registers
+// independently. Members are seeded by their index alone, which makes groups
+// of the same size built in different processes comparable.
+type Group struct {
+	sketches []*LogLogBeta
+	seeds    []uint64
+}
+
+// NewGroup returns a group of n sketches, each configured with opts. Fewer
+// than two members can't show any spread, so n is raised to 2 if smaller.
+func NewGroup(n int, opts ...Option) *Group {
+	if n < 2 {
+		n = 2
+	}
+	g := &Group{
+		sketches: make([]*LogLogBeta, n),
+		seeds:    make([]uint64, n),
+	}
+	for i := range g.sketches {
+		g.sketches[i] = New(opts...)
+		g.seeds[i] = mix64(uint64(i) + 1)
+	}
+	return g
+}
+
+// Len returns the number of sketches in the group.
+func (g *Group) Len() int {
+	return len(g.sketches)
+}
+
+// AddHash adds an already hashed value to every sketch in the group.
+func (g *Group) AddHash(x uint64) {
+	for i, s := range g.sketches {
+		s.AddHash(mix64(x ^ g.seeds[i]))
+	}
+}
+
+// Add hashes value once, with the hash the group's sketches were configured
+// with, and adds it to every sketch in the group.
+func (g *Group) Add(value []byte) {
+	g.AddHash(g.sketches[0].hash(value))
+}
+
+// tQuantile975 holds the 97.5th percentile of Student's t distribution for 1
+// to 30 degrees of freedom. Beyond that the normal value 1.96 is used.
+var tQuantile975 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// CardinalityWithEmpiricalCI returns the mean of the members' estimates and
+// a 95% confidence interval for it computed from their sample standard
+// deviation, using Student's t distribution since groups are usually small.
+// The interval describes the mean, which is N times less variable than a
+// single member; the lower bound is never negative.
+func (g *Group) CardinalityWithEmpiricalCI() (mean, lo, hi float64) {
+	n := float64(len(g.sketches))
+	for _, s := range g.sketches {
+		mean += s.estimate()
+	}
+	mean /= n
+
+	ss := 0.0
+	for _, s := range g.sketches {
+		d := s.estimate() - mean
+		ss += d * d
+	}
+	sd := math.Sqrt(ss / (n - 1))
+
+	t := 1.96
+	if df := len(g.sketches) - 1; df <= len(tQuantile975) {
+		t = tQuantile975[df-1]
+	}
+	half := t * sd / math.Sqrt(n)
+	lo = mean - half
+	if lo < 0 {
+		lo = 0
+	}
+	return mean, lo, mean + half
+}
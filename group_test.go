@@ -0,0 +1,50 @@
+package loglogbeta
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	if NewGroup(0).Len() != 2 {
+		t.Error("expected a group of at least 2 sketches")
+	}
+
+	empty := NewGroup(4)
+	if mean, lo, hi := empty.CardinalityWithEmpiricalCI(); mean != 0 || lo != 0 || hi != 0 {
+		t.Errorf("empty group: expected 0, got %v [%v, %v]", mean, lo, hi)
+	}
+
+	const exact = 200000
+	g := NewGroup(8)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < exact; i++ {
+		g.AddHash(rng.Uint64())
+	}
+
+	// The members must disagree, otherwise they aren't independent.
+	if g.sketches[0].Cardinality() == g.sketches[1].Cardinality() {
+		t.Error("members produced identical estimates")
+	}
+
+	mean, lo, hi := g.CardinalityWithEmpiricalCI()
+	if !(lo < mean && mean < hi) {
+		t.Fatalf("expected lo < mean < hi, got %v [%v, %v]", mean, lo, hi)
+	}
+	if lo > exact || hi < exact {
+		t.Errorf("exact count %d outside the interval [%v, %v]", exact, lo, hi)
+	}
+	if width := (hi - lo) / mean; width > 0.05 {
+		t.Errorf("interval suspiciously wide: %.3f of the estimate", width)
+	}
+
+	// Add and AddHash with the configured hash agree.
+	a, b := NewGroup(3), NewGroup(3)
+	a.Add([]byte("hello"))
+	b.AddHash(metroHash([]byte("hello")))
+	for i := range a.sketches {
+		if a.sketches[i].Fingerprint() != b.sketches[i].Fingerprint() {
+			t.Errorf("member %d: Add and AddHash differ", i)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package loglogbeta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	metro "github.com/dgryski/go-metro"
+)
+
+// defaultSeed is the metro seed of the default hash.
+const defaultSeed = 1337
+
+// maxHashIDLen is the longest hash id the binary encodings can record; they
+// store its length in a single byte.
+const maxHashIDLen = 255
+
+func metroHash(value []byte) uint64 {
+	return metro.Hash64(value, defaultSeed)
+}
+
+// WithHasherMetro makes Add hash values with metro, seeded with 1337. This is
+// the default.
+func WithHasherMetro() Option {
+	return WithHasherMetroSeed(defaultSeed)
+}
+
+// WithHasherMetroSeed makes Add hash values with metro seeded with seed.
+// A secret seed keeps an adversary who can choose the inputs from crafting
+// values that all land in a few registers. Its hash id is "metro:<seed>",
+// or "metro" for the default seed.
+func WithHasherMetroSeed(seed uint64) Option {
+	return func(llb *LogLogBeta) {
+		if seed == defaultSeed {
+			llb.hash, llb.hashID = metroHash, ""
+			return
+		}
+		llb.hash = func(value []byte) uint64 { return metro.Hash64(value, seed) }
+		llb.hashID = "metro:" + strconv.FormatUint(seed, 10)
+	}
+}
+
+// WithHasherXXHash makes Add hash values with 64-bit xxHash.
+//
+// The choice of hash doesn't affect the estimator, since every preset yields
+// uniformly distributed 64-bit values, but registers built with different
+// hashes don't describe the same elements. Only merge sketches that were
+// built with the same hasher. Its hash id is "xxhash".
+func WithHasherXXHash() Option {
+	return func(llb *LogLogBeta) {
+		llb.hash, llb.hashID = xxhash.Sum64, "xxhash"
+	}
+}
+
+// WithHasher makes Add hash values with h, for example to match sketches
+// built by another system from murmur3 hashes. id names the hash, seed
+// included, and is recorded by MarshalBinary: Merge refuses sketches with a
+// different id, and UnmarshalBinary refuses blobs with a different id, so
+// incompatible registers are never combined. Choose an id of at most 255
+// bytes that no other hash configuration uses. The ids of the built-in
+// hashers, "metro", "metro:<seed>", "xxhash" and "redis", are reserved.
+//
+// h must spread its output over all 64 bits. For a 128-bit hash use one of
+// its halves; for a 32-bit hash use WithHasher32.
+func WithHasher(id string, h func([]byte) uint64) Option {
+	if id == "" || id == "metro" || id == "xxhash" || id == "redis" || strings.HasPrefix(id, "metro:") ||
+		len(id) > maxHashIDLen || h == nil {
+		panic(fmt.Sprintf("loglogbeta: WithHasher: invalid id %q or nil hash", id))
+	}
+	return func(llb *LogLogBeta) {
+		llb.hash, llb.hashID = h, id
+	}
+}
+
+// WithHasher32 is WithHasher for a 32-bit hash, whose value becomes the top
+// 32 bits of the hash AddHash sees. With only 32-p bits left for the rank,
+// registers saturate at 33-p instead of 65-p and the estimate stays usable
+// up to about 2^32/30, some 140 million elements. Collisions among 32-bit
+// hashes bias it low by about n/2^33 well before that.
+func WithHasher32(id string, h func([]byte) uint32) Option {
+	if h == nil {
+		panic("loglogbeta: WithHasher32: nil hash")
+	}
+	return WithHasher(id, func(value []byte) uint64 { return uint64(h(value)) << 32 })
+}
+
+// HashID returns the id of the hash Add uses, as recorded by MarshalBinary.
+func (llb *LogLogBeta) HashID() string {
+	return hashName(llb.hashID)
+}
+
+// hashName maps the stored id, empty for the default hash, to its name.
+func hashName(id string) string {
+	if id == "" {
+		return "metro"
+	}
+	return id
+}
+
+// storedID maps a hash name, as returned by HashID, to the id stored in
+// llb.hashID and the encodings, empty for the default hash.
+func storedID(name string) string {
+	if name == "metro" {
+		return ""
+	}
+	return name
+}
+
+// hashByID returns the built-in hasher with the given MarshalBinary id, or
+// nil if id names a caller-supplied hash.
+func hashByID(id string) func([]byte) uint64 {
+	switch {
+	case id == "":
+		return metroHash
+	case id == "xxhash":
+		return xxhash.Sum64
+	case id == "redis":
+		return redisHash
+	case strings.HasPrefix(id, "metro:"):
+		seed, err := strconv.ParseUint(id[len("metro:"):], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return func(value []byte) uint64 { return metro.Hash64(value, seed) }
+	}
+	return nil
+}
+
+// checkHash returns an error wrapping ErrHashMismatch unless id is the
+// stored id of llb's hash.
+func (llb *LogLogBeta) checkHash(id string) error {
+	if id != llb.hashID {
+		return fmt.Errorf("%w: got %q, want %q", ErrHashMismatch, hashName(id), llb.HashID())
+	}
+	return nil
+}
+
+// adoptHash applies the stored hash id of a decoded blob: a zero LogLogBeta
+// takes on that hash, any other sketch must already use it. A zero sketch
+// can only take on the built-in hashes and returns an error wrapping
+// ErrUnknownHash for any other id.
+func (llb *LogLogBeta) adoptHash(id string) error {
+	if llb.hash != nil {
+		return llb.checkHash(id)
+	}
+	h := hashByID(id)
+	if h == nil {
+		return fmt.Errorf("%w %q; decode into a sketch created WithHasher", ErrUnknownHash, id)
+	}
+	llb.hashID, llb.hash = id, h
+	return nil
+}
+
+// Fingerprint returns a 32-character hex digest of the registers. Sketches
+// with identical registers have identical fingerprints and any register
+// change alters it, so it can stand in for the full register array as a
+// cache or deduplication key. It is not a cryptographic digest.
+func (llb *LogLogBeta) Fingerprint() string {
+	hi, lo := metro.Hash128(llb.dense(), 1337)
+	return fmt.Sprintf("%016x%016x", hi, lo)
+}
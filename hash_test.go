@@ -0,0 +1,177 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestHasherPresets(t *testing.T) {
+	const n = 200000
+	def, met, xx := New(), New(WithHasherMetro()), New(WithHasherXXHash())
+	for i := 0; i < n; i++ {
+		v := []byte(strconv.Itoa(i))
+		def.Add(v)
+		met.Add(v)
+		xx.Add(v)
+	}
+
+	if !bytes.Equal(def.registers, met.registers) {
+		t.Error("WithHasherMetro differs from the default hasher")
+	}
+	if bytes.Equal(met.registers, xx.registers) {
+		t.Error("WithHasherXXHash produced the same registers as metro")
+	}
+	for name, llb := range map[string]*LogLogBeta{"metro": met, "xxhash": xx} {
+		if ratio := 100 * estimateError(llb.Cardinality(), n); ratio > 2 {
+			t.Errorf("%s: expected %d, got %d (%.2f%% error)", name, n, llb.Cardinality(), ratio)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, b := buildRange(0, 5000), buildRange(0, 5000)
+	fa := a.Fingerprint()
+	if len(fa) != 32 {
+		t.Errorf("expected 32 hex characters, got %q", fa)
+	}
+	if fa != b.Fingerprint() {
+		t.Error("identical sketches have different fingerprints")
+	}
+
+	seen := map[string]int{fa: -1, New().Fingerprint(): -2}
+	for i := 0; i < 200; i++ {
+		c := a.Clone()
+		c.registers[i*37%len(c.registers)]++
+		f := c.Fingerprint()
+		if j, ok := seen[f]; ok {
+			t.Fatalf("register change %d produced the fingerprint of %d", i, j)
+		}
+		seen[f] = i
+	}
+}
+
+func fnv64(value []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(value)
+	return h.Sum64()
+}
+
+func TestWithHasher(t *testing.T) {
+	custom := New(WithHasher("fnv64a", fnv64))
+	custom.Add([]byte("hello"))
+	ref := New()
+	ref.AddHash(fnv64([]byte("hello")))
+	if !bytes.Equal(custom.registers, ref.registers) || custom.HashID() != "fnv64a" {
+		t.Fatal("WithHasher didn't install the hash")
+	}
+
+	def, xx := New(), New(WithHasherXXHash())
+	for _, other := range []*LogLogBeta{def, xx} {
+		if CanMerge(custom, other) {
+			t.Errorf("%s: expected sketches with different hashes not to be mergeable", other.HashID())
+		}
+		if err := custom.Merge(other); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%s: expected ErrHashMismatch, got %v", other.HashID(), err)
+		}
+	}
+
+	data, err := custom.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New().UnmarshalBinary(data); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected ErrHashMismatch decoding into the default hash, got %v", err)
+	}
+	same := New(WithHasher("fnv64a", fnv64))
+	if err := same.UnmarshalBinary(data); err != nil || !bytes.Equal(same.registers, custom.registers) {
+		t.Errorf("decoding into the same hash: %v", err)
+	}
+
+	// A caller-supplied hash can't be restored, so a zero sketch refuses
+	// the blob rather than failing on its first Add.
+	var zero LogLogBeta
+	if err := zero.UnmarshalBinary(data); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected ErrUnknownHash decoding into a zero sketch, got %v", err)
+	}
+	if zero.hash != nil || zero.numRegisters() != 0 {
+		t.Error("a refused blob changed the zero sketch")
+	}
+
+	for _, id := range []string{"", "metro", "metro:7", "xxhash"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected WithHasher(%q) to panic", id)
+				}
+			}()
+			WithHasher(id, fnv64)
+		}()
+	}
+}
+
+func TestHashIDRoundTrip(t *testing.T) {
+	cases := []struct {
+		opt  Option
+		id   string
+		hash func([]byte) uint64
+	}{
+		{WithHasherMetro(), "metro", metroHash},
+		{WithHasherMetroSeed(1337), "metro", metroHash},
+		{WithHasherMetroSeed(42), "metro:42", nil},
+		{WithHasherXXHash(), "xxhash", xxhash.Sum64},
+	}
+	for _, c := range cases {
+		llb := New(c.opt)
+		if llb.HashID() != c.id {
+			t.Errorf("expected id %q, got %q", c.id, llb.HashID())
+		}
+		llb.Add([]byte("hello"))
+		if c.hash != nil {
+			ref := New()
+			ref.AddHash(c.hash([]byte("hello")))
+			if !bytes.Equal(llb.registers, ref.registers) {
+				t.Errorf("%s: unexpected hash", c.id)
+			}
+		}
+
+		// A zero sketch restores the built-in hashers from the id.
+		data, err := llb.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got LogLogBeta
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		fresh := New(c.opt)
+		got.Add([]byte("world"))
+		fresh.Add([]byte("world"))
+		fresh.Add([]byte("hello"))
+		if got.HashID() != c.id || !bytes.Equal(got.registers, fresh.registers) {
+			t.Errorf("%s: decoded sketch hashes differently", c.id)
+		}
+	}
+}
+
+func TestWithHasher32(t *testing.T) {
+	const n = 100000
+	llb := New(WithHasher32("fnv32a", func(value []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(value)
+		return h.Sum32()
+	}))
+	for i := 0; i < n; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+	if ratio := 100 * estimateError(llb.Cardinality(), n); ratio > 3 {
+		t.Errorf("expected %d, got %d (%.2f%% error)", n, llb.Cardinality(), ratio)
+	}
+	if max := llb.MaxRegister(); max > 32-precision+1 {
+		t.Errorf("register %d exceeds the 32-bit rank cap", max)
+	}
+}
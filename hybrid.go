@@ -0,0 +1,311 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const hybridVersion = 1
+
+var (
+	errHybridOrder    = errors.New("loglogbeta: hybrid hashes are not sorted")
+	errHybridPromoted = errors.New("loglogbeta: hybrid is no longer exact")
+)
+
+// Hybrid counts exactly while it has seen at most K distinct hashes and
+// switches to a LogLogBeta sketch beyond that. In the exact phase it keeps
+// the hashes in a sorted slice, 8 bytes each, so a small K costs far less
+// than a sketch's registers and most small sets are counted exactly. When
+// the K+1st distinct hash arrives, a sketch is created, every stored hash is
+// replayed into it with AddHash and the slice is released; the counter stays
+// approximate from then on.
+//
+// Exact counts are exact in terms of hashes: two elements with the same
+// 64-bit hash count once, as they would in the sketch.
+type Hybrid struct {
+	k      int
+	hashes []uint64
+	sketch *LogLogBeta
+	// opts configures the sketch created on promotion, and hash and hashID
+	// are the hash they choose; hash is nil only in a zero Hybrid, which
+	// takes on the hash of the blob it decodes. p is the precision of that sketch,
+	// which UpgradePrecision may raise above the one opts choose; 0 leaves
+	// it to opts.
+	opts   []Option
+	hash   func([]byte) uint64
+	hashID string
+	p      uint8
+}
+
+type savedHybrid struct {
+	Version int
+	K       int
+	Hashes  []uint64
+	// HashID is the stored id of the hash, as in a sketch's hashID, so that
+	// exact hashes are never decoded into a counter using another hash.
+	HashID string
+	// Precision is the precision an exact counter promotes to, 0 in blobs
+	// written before UpgradePrecision existed.
+	Precision uint8
+	// Sketch is the MarshalBinary form of the sketch, set once promoted.
+	Sketch []byte
+}
+
+// NewHybrid returns an empty Hybrid that counts exactly up to k distinct
+// hashes and then promotes to a sketch created with opts, whose hash Add
+// uses throughout. A negative k is treated as 0, which promotes on the first
+// hash.
+func NewHybrid(k int, opts ...Option) *Hybrid {
+	if k < 0 {
+		k = 0
+	}
+	h := &Hybrid{k: k, hash: metroHash, p: precision}
+	if len(opts) > 0 {
+		// A sparse template finds the hash and precision without allocating
+		// registers.
+		tmpl := New(append([]Option{WithSparseRegisters()}, opts...)...)
+		h.opts, h.hash, h.hashID, h.p = opts, tmpl.hash, tmpl.hashID, tmpl.p
+	}
+	return h
+}
+
+// Exact reports whether h is still in the exact phase.
+func (h *Hybrid) Exact() bool {
+	return h.sketch == nil
+}
+
+// Precision returns the precision of h's sketch, or in the exact phase the
+// precision it will be promoted to.
+func (h *Hybrid) Precision() uint8 {
+	switch {
+	case h.sketch != nil:
+		return h.sketch.p
+	case h.p != 0:
+		return h.p
+	}
+	return precision
+}
+
+// UpgradePrecision raises the precision h is promoted to to p, a one-way
+// escape hatch for a small counter that turns out to need a finer sketch.
+// In the exact phase h still holds every hash, so they are replayed into a
+// sketch of precision p on promotion, exactly as if h had been created
+// WithPrecision(p). Once promoted the hashes are gone and it returns an
+// error wrapping errHybridPromoted. It returns an error wrapping
+// ErrInvalidPrecision for an invalid p and an *IncompatibleError wrapping
+// ErrPrecisionMismatch for one below the current precision.
+func (h *Hybrid) UpgradePrecision(p uint8) error {
+	if h.sketch != nil {
+		return fmt.Errorf("%w: can't raise precision %d to %d", errHybridPromoted, h.sketch.p, p)
+	}
+	if err := checkPrecision(p); err != nil {
+		return err
+	}
+	if cur := h.Precision(); p < cur {
+		return &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(p), Want: uint64(cur)}
+	}
+	h.p = p
+	return nil
+}
+
+// AddHash inserts an already hashed value.
+func (h *Hybrid) AddHash(x uint64) {
+	if h.sketch != nil {
+		h.sketch.AddHash(x)
+		return
+	}
+	i := sort.Search(len(h.hashes), func(i int) bool { return h.hashes[i] >= x })
+	if i < len(h.hashes) && h.hashes[i] == x {
+		return
+	}
+	h.hashes = append(h.hashes, 0)
+	copy(h.hashes[i+1:], h.hashes[i:])
+	h.hashes[i] = x
+	if len(h.hashes) > h.k {
+		h.promote()
+	}
+}
+
+// Add hashes value with the hash chosen by NewHybrid's options, by default
+// metro seeded with 1337, and inserts it.
+func (h *Hybrid) Add(value []byte) {
+	if h.hash != nil {
+		h.AddHash(h.hash(value))
+		return
+	}
+	h.AddHash(metroHash(value))
+}
+
+// Cardinality returns the exact number of distinct hashes in the exact
+// phase and the sketch's estimate afterwards.
+func (h *Hybrid) Cardinality() uint64 {
+	if h.sketch != nil {
+		return h.sketch.Cardinality()
+	}
+	return uint64(len(h.hashes))
+}
+
+// promote switches h to the approximate phase.
+func (h *Hybrid) promote() {
+	h.sketch = New(h.sketchOpts(h.p)...)
+	for _, x := range h.hashes {
+		h.sketch.AddHash(x)
+	}
+	h.hashes = nil
+}
+
+// sketchOpts returns the options for h's sketch: opts, then precision p
+// unless it is 0 and h's hash unless it is unset.
+func (h *Hybrid) sketchOpts(p uint8) []Option {
+	opts := h.opts[:len(h.opts):len(h.opts)]
+	if p != 0 {
+		opts = append(opts, WithPrecision(p))
+	}
+	if h.hash != nil {
+		hash, id := h.hash, h.hashID
+		opts = append(opts, func(llb *LogLogBeta) { llb.hash, llb.hashID = hash, id })
+	}
+	return opts
+}
+
+// checkHash returns an error wrapping ErrHashMismatch unless id is the
+// stored id of h's hash.
+func (h *Hybrid) checkHash(id string) error {
+	if id != h.hashID {
+		return fmt.Errorf("%w: got %q, want %q", ErrHashMismatch, hashName(id), hashName(h.hashID))
+	}
+	return nil
+}
+
+// Merge makes h the union of h and other, keeping h's K. The union of two
+// exact counters stays exact while it has at most K distinct hashes;
+// otherwise h is promoted and other's hashes or registers are merged in.
+// Sketches of different precisions, after UpgradePrecision, are unioned at
+// the lower one by folding the finer sketch's registers down. other is not
+// modified. It returns an error wrapping ErrHashMismatch and leaves h
+// unchanged unless both counters use the same hash, since their hashes
+// don't describe the same elements.
+func (h *Hybrid) Merge(other *Hybrid) error {
+	if err := h.checkHash(other.hashID); err != nil {
+		return err
+	}
+	if h.sketch == nil && other.sketch == nil {
+		h.hashes = mergeSorted(h.hashes, other.hashes)
+		if len(h.hashes) > h.k {
+			h.promote()
+		}
+		return nil
+	}
+	if h.sketch == nil {
+		h.promote()
+	}
+	if o := other.sketch; o != nil {
+		switch {
+		case o.p == h.sketch.p:
+			return h.sketch.Merge(o)
+		case o.p > h.sketch.p:
+			return h.sketch.AbsorbHigher(o)
+		}
+		low := o.Clone()
+		if err := low.AbsorbHigher(h.sketch); err != nil {
+			return err
+		}
+		h.sketch = low
+		return nil
+	}
+	for _, x := range other.hashes {
+		h.sketch.AddHash(x)
+	}
+	return nil
+}
+
+// mergeSorted returns the sorted union of two sorted, duplicate-free slices.
+func mergeSorted(a, b []uint64) []uint64 {
+	out := make([]uint64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. Exact
+// counters store their hashes and promoted ones the sketch, both along with
+// the id of the hash.
+func (h *Hybrid) MarshalBinary() ([]byte, error) {
+	s := savedHybrid{Version: hybridVersion, K: h.k, Hashes: h.hashes, HashID: h.hashID, Precision: h.Precision()}
+	if h.sketch != nil {
+		data, err := h.sketch.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		s.Sketch = data
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. h
+// takes on the blob's precision, upgraded or not, and keeps its options. It
+// returns an error wrapping ErrHashMismatch and leaves h unchanged if the
+// blob was written with another hash; a zero Hybrid takes on the blob's
+// hash instead, provided it is one of the built-in ones, and returns an
+// error wrapping ErrUnknownHash otherwise.
+func (h *Hybrid) UnmarshalBinary(data []byte) error {
+	var s savedHybrid
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != hybridVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(s.Version), Want: hybridVersion}
+	}
+	r := Hybrid{opts: h.opts, hash: h.hash, hashID: h.hashID, p: h.p}
+	if r.hash == nil {
+		if r.hash = hashByID(s.HashID); r.hash == nil {
+			return fmt.Errorf("%w %q; decode into a Hybrid created WithHasher", ErrUnknownHash, s.HashID)
+		}
+		r.hashID = s.HashID
+	} else if err := r.checkHash(s.HashID); err != nil {
+		return err
+	}
+	if s.Precision != 0 {
+		if err := checkPrecision(s.Precision); err != nil {
+			return err
+		}
+		r.p = s.Precision
+	}
+
+	if s.Sketch != nil {
+		r.sketch = New(r.sketchOpts(r.p)...)
+		if err := r.sketch.UnmarshalBinary(s.Sketch); err != nil {
+			return err
+		}
+	}
+	for i := 1; r.sketch == nil && i < len(s.Hashes); i++ {
+		if s.Hashes[i-1] >= s.Hashes[i] {
+			return errHybridOrder
+		}
+	}
+	r.k, r.hashes = s.K, s.Hashes
+	if r.sketch == nil && len(r.hashes) > r.k {
+		r.promote()
+	}
+	*h = r
+	return nil
+}
@@ -0,0 +1,283 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func hybridRange(k, from, to int) *Hybrid {
+	h := NewHybrid(k)
+	for i := from; i < to; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+	return h
+}
+
+func TestHybrid(t *testing.T) {
+	h := hybridRange(1000, 0, 1000)
+	h.Add([]byte("5")) // duplicate
+	if !h.Exact() || h.Cardinality() != 1000 {
+		t.Fatalf("expected exact count 1000, got %d (exact=%v)", h.Cardinality(), h.Exact())
+	}
+
+	h.Add([]byte("1000"))
+	if h.Exact() {
+		t.Fatal("expected promotion past K")
+	}
+	exp := buildRange(0, 1001)
+	if !bytes.Equal(h.sketch.registers, exp.registers) {
+		t.Error("promoted sketch differs from adding the elements directly")
+	}
+	if h.Cardinality() != exp.Cardinality() {
+		t.Errorf("expected %d, got %d", exp.Cardinality(), h.Cardinality())
+	}
+}
+
+func TestHybridMerge(t *testing.T) {
+	a, b := hybridRange(100, 0, 40), hybridRange(100, 20, 70)
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Exact() || a.Cardinality() != 70 {
+		t.Errorf("exact union: expected 70, got %d (exact=%v)", a.Cardinality(), a.Exact())
+	}
+
+	if err := a.Merge(hybridRange(100, 50, 150)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Exact() {
+		t.Fatal("expected the union to promote past K")
+	}
+	if !bytes.Equal(a.sketch.registers, buildRange(0, 150).registers) {
+		t.Error("promoted union differs")
+	}
+
+	// Exact into approximate and approximate into exact.
+	approx := hybridRange(10, 0, 500)
+	if err := approx.Merge(hybridRange(10, 495, 505)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(approx.sketch.registers, buildRange(0, 505).registers) {
+		t.Error("exact into approximate differs")
+	}
+	small := hybridRange(1000, 600, 610)
+	if err := small.Merge(approx); err != nil {
+		t.Fatal(err)
+	}
+	if small.Exact() || !bytes.Equal(small.sketch.registers, buildRange(0, 505).Plus(buildRange(600, 610)).registers) {
+		t.Error("approximate into exact differs")
+	}
+}
+
+func TestHybridOptions(t *testing.T) {
+	opts := []Option{WithPrecision(10), WithHasherXXHash()}
+	h := NewHybrid(50, opts...)
+	exp := New(opts...)
+	for i := 0; i < 100; i++ {
+		v := []byte(strconv.Itoa(i))
+		h.Add(v)
+		exp.Add(v)
+	}
+	if h.Exact() {
+		t.Fatal("expected promotion past K")
+	}
+	if h.sketch.Precision() != 10 || h.sketch.HashID() != "xxhash" {
+		t.Errorf("promoted to precision %d and hash %q", h.sketch.Precision(), h.sketch.HashID())
+	}
+	if !bytes.Equal(h.sketch.registers, exp.registers) {
+		t.Error("promoted sketch differs from adding the elements directly")
+	}
+}
+
+func TestHybridUpgradePrecision(t *testing.T) {
+	h := hybridRange(100, 0, 50)
+	if h.Precision() != 14 {
+		t.Fatalf("expected precision 14, got %d", h.Precision())
+	}
+	if err := h.UpgradePrecision(16); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.UpgradePrecision(15); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch lowering the precision, got %v", err)
+	}
+	if err := h.UpgradePrecision(MaxPrecision + 1); !errors.Is(err, ErrInvalidPrecision) {
+		t.Errorf("expected ErrInvalidPrecision, got %v", err)
+	}
+	if !h.Exact() || h.Precision() != 16 || h.Cardinality() != 50 {
+		t.Fatalf("after upgrade: exact=%v precision %d count %d", h.Exact(), h.Precision(), h.Cardinality())
+	}
+
+	// The upgrade survives a round trip, even into a zero Hybrid.
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Hybrid
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Precision() != 16 {
+		t.Errorf("round trip: expected precision 16, got %d", got.Precision())
+	}
+
+	exp := New(WithPrecision(16))
+	for i := 0; i < 101; i++ {
+		v := []byte(strconv.Itoa(i))
+		exp.Add(v)
+		if i >= 50 {
+			h.Add(v)
+			got.Add(v)
+		}
+	}
+	for name, c := range map[string]*Hybrid{"upgraded": h, "decoded": &got} {
+		if c.Exact() || c.sketch.Precision() != 16 {
+			t.Fatalf("%s: expected promotion at precision 16, got exact=%v precision %d", name, c.Exact(), c.Precision())
+		}
+		if !bytes.Equal(c.sketch.registers, exp.registers) {
+			t.Errorf("%s: promoted sketch differs from adding the elements at precision 16", name)
+		}
+	}
+	if err := h.UpgradePrecision(18); !errors.Is(err, errHybridPromoted) {
+		t.Errorf("expected errHybridPromoted, got %v", err)
+	}
+}
+
+func TestHybridMergePrecisions(t *testing.T) {
+	fine := func() *Hybrid {
+		h := NewHybrid(10)
+		if err := h.UpgradePrecision(16); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3000; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+		return h
+	}
+	exp := buildRange(0, 5000).dense()
+
+	// Either way round, the union is the one of the coarser sketch, and
+	// folding is exact.
+	a := fine()
+	if err := a.Merge(hybridRange(10, 2000, 5000)); err != nil {
+		t.Fatal(err)
+	}
+	b := hybridRange(10, 2000, 5000)
+	if err := b.Merge(fine()); err != nil {
+		t.Fatal(err)
+	}
+	for name, h := range map[string]*Hybrid{"fine into coarse": b, "coarse into fine": a} {
+		if h.Precision() != 14 || !bytes.Equal(h.sketch.dense(), exp) {
+			t.Errorf("%s: precision %d, registers differ from the union at 14", name, h.Precision())
+		}
+	}
+}
+
+func TestHybridMergeHash(t *testing.T) {
+	add := func(h *Hybrid, from, to int) *Hybrid {
+		for i := from; i < to; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+		return h
+	}
+	for name, c := range map[string]struct{ h, other *Hybrid }{
+		"exact":      {hybridRange(100, 0, 10), add(NewHybrid(100, WithHasherXXHash()), 0, 10)},
+		"promoted":   {hybridRange(10, 0, 100), add(NewHybrid(10, WithHasherXXHash()), 0, 100)},
+		"into exact": {hybridRange(100, 0, 10), add(NewHybrid(10, WithHasherXXHash()), 0, 100)},
+	} {
+		before, err := c.h.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.h.Merge(c.other); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%s: expected ErrHashMismatch, got %v", name, err)
+		}
+		if after, _ := c.h.MarshalBinary(); !bytes.Equal(before, after) {
+			t.Errorf("%s: a failed Merge changed the counter", name)
+		}
+	}
+	if err := hybridRange(100, 0, 10).Merge(add(NewHybrid(100, WithHasherMetro()), 0, 10)); err != nil {
+		t.Errorf("explicit default hash: %v", err)
+	}
+}
+
+func TestHybridMarshalHash(t *testing.T) {
+	fill := func(h *Hybrid, n int) *Hybrid {
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+		return h
+	}
+	custom := WithHasher("fnv", func(v []byte) uint64 { return metroHash(v) ^ 0xf00 })
+	for _, n := range []int{10, 100} {
+		data, err := fill(NewHybrid(50, WithHasherXXHash()), n).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := hybridRange(50, 0, 5)
+		if err := h.UnmarshalBinary(data); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%d: expected ErrHashMismatch, got %v", n, err)
+		}
+		if h.Cardinality() != 5 {
+			t.Errorf("%d: a failed UnmarshalBinary changed the counter", n)
+		}
+
+		// A zero Hybrid takes the hash on, so the elements match again.
+		var got Hybrid
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		before := got.Cardinality()
+		if fill(&got, n).Cardinality() != before {
+			t.Errorf("%d: re-adding the elements changed the count from %d to %d", n, before, got.Cardinality())
+		}
+		if err := got.Merge(NewHybrid(50, WithHasherXXHash())); err != nil {
+			t.Errorf("%d: merging after decoding: %v", n, err)
+		}
+
+		data, err = fill(NewHybrid(50, custom), n).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := new(Hybrid).UnmarshalBinary(data); !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("%d: expected ErrUnknownHash, got %v", n, err)
+		}
+		if err := NewHybrid(50, custom).UnmarshalBinary(data); err != nil {
+			t.Errorf("%d: decoding with the same custom hash: %v", n, err)
+		}
+	}
+}
+
+func TestHybridMarshal(t *testing.T) {
+	for _, h := range []*Hybrid{NewHybrid(10), hybridRange(100, 0, 50), hybridRange(100, 0, 5000)} {
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Hybrid
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if got.k != h.k || got.Exact() != h.Exact() || got.Cardinality() != h.Cardinality() {
+			t.Errorf("round trip: expected k=%d exact=%v %d, got k=%d exact=%v %d",
+				h.k, h.Exact(), h.Cardinality(), got.k, got.Exact(), got.Cardinality())
+		}
+	}
+
+	encode := func(s savedHybrid) []byte {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	var h Hybrid
+	if err := h.UnmarshalBinary(encode(savedHybrid{Version: 2})); !errors.Is(err, ErrVersionUnsupported) {
+		t.Errorf("expected ErrVersionUnsupported, got %v", err)
+	}
+	if err := h.UnmarshalBinary(encode(savedHybrid{Version: 1, K: 5, Hashes: []uint64{3, 3}})); err != errHybridOrder {
+		t.Errorf("expected errHybridOrder, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const jsonVersion = 1
+
+// jsonLLB is the JSON form of a sketch. Registers holds the compact
+// encoding, which encoding/json writes as base64.
+type jsonLLB struct {
+	Version   int    `json:"version"`
+	Precision uint8  `json:"precision"`
+	Hash      string `json:"hash"`
+	Registers []byte `json:"registers"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. A sketch is written
+// as an object holding the version of this layout, the precision, the name
+// of the hash as returned by HashID, and the registers in their compact
+// encoding, base64 encoded:
+//
+//	{"version":1,"precision":14,"hash":"metro","registers":"TExCQwIOAwA..."}
+//
+// As with the compact encoding, alpha and metadata are not stored.
+func (llb *LogLogBeta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonLLB{
+		Version:   jsonVersion,
+		Precision: llb.p,
+		Hash:      llb.HashID(),
+		Registers: llb.smallestCompact(),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It reads the
+// objects written by MarshalJSON and also strings holding the MarshalText
+// form. A JSON null leaves llb unchanged. Precision and hash are handled as
+// by UnmarshalBinary: a zero LogLogBeta takes them on from the document and
+// any other sketch only accepts its own.
+func (llb *LogLogBeta) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return llb.UnmarshalText([]byte(text))
+	}
+
+	var j jsonLLB
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Version != jsonVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(j.Version), Want: jsonVersion}
+	}
+	if len(j.Registers) > 5 && j.Registers[5] != j.Precision {
+		return fmt.Errorf("loglogbeta: precision %d doesn't match the registers' %d", j.Precision, j.Registers[5])
+	}
+	return llb.unmarshalPayload(j.Hash, j.Registers)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The text is
+// the compact encoding of the registers in standard base64, which carries
+// its own version and precision. Sketches that don't use the default hash
+// prefix it with the hash's name and a colon, as in "xxhash:TExCQwIOAwZ4eGhh...".
+func (llb *LogLogBeta) MarshalText() ([]byte, error) {
+	payload := llb.smallestCompact()
+	prefix := ""
+	if llb.hashID != "" {
+		prefix = llb.hashID + ":"
+	}
+	text := make([]byte, len(prefix)+base64.StdEncoding.EncodedLen(len(payload)))
+	copy(text, prefix)
+	base64.StdEncoding.Encode(text[len(prefix):], payload)
+	return text, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface, reading
+// the form written by MarshalText. Precision and hash are handled as by
+// UnmarshalBinary.
+func (llb *LogLogBeta) UnmarshalText(text []byte) error {
+	s := string(text)
+	id := ""
+	// The base64 alphabet has no colon, so the last one ends the hash name.
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		id, s = s[:i], s[i+1:]
+	}
+	payload, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("loglogbeta: decoding text: %w", err)
+	}
+	return llb.unmarshalPayload(id, payload)
+}
+
+// unmarshalPayload decodes a compact encoding hashed with the hash named
+// id, as returned by HashID.
+func (llb *LogLogBeta) unmarshalPayload(id string, payload []byte) error {
+	if err := llb.adoptHash(storedID(id)); err != nil {
+		return err
+	}
+	return llb.UnmarshalCompact(payload)
+}
@@ -0,0 +1,131 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	p10, _ := NewWithPrecision(10)
+	for name, llb := range map[string]*LogLogBeta{
+		"empty":  New(),
+		"small":  buildRange(0, 100),
+		"full":   buildRange(0, 1000000),
+		"p10":    p10,
+		"xxhash": New(WithHasherXXHash()),
+	} {
+		llb.Add([]byte("x"))
+
+		data, err := json.Marshal(llb)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if doc["version"] != float64(jsonVersion) || doc["precision"] != float64(llb.Precision()) || doc["hash"] != llb.HashID() {
+			t.Errorf("%s: unexpected metadata in %.80s", name, data)
+		}
+
+		var got LogLogBeta
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got.dense(), llb.dense()) || got.Precision() != llb.Precision() || got.HashID() != llb.HashID() {
+			t.Errorf("%s: JSON round trip differs", name)
+		}
+		checkHist(t, name, &got)
+
+		text, err := llb.MarshalText()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got = LogLogBeta{}
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got.dense(), llb.dense()) || got.Precision() != llb.Precision() || got.HashID() != llb.HashID() {
+			t.Errorf("%s: text round trip differs", name)
+		}
+	}
+
+	// The run-length encoding keeps a small sketch small, and a full one
+	// costs no more than the plain registers.
+	if data, _ := json.Marshal(buildRange(0, 100)); len(data) > 1000 {
+		t.Errorf("small sketch took %d bytes", len(data))
+	}
+	if data, _ := json.Marshal(buildRange(0, 1000000)); len(data) > 4*(int(m)+CompactHeaderSize+4)/3+100 {
+		t.Errorf("full sketch took %d bytes", len(data))
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	type doc struct {
+		Name   string      `json:"name"`
+		Sketch *LogLogBeta `json:"sketch"`
+		Text   *LogLogBeta `json:"text"`
+	}
+	llb := buildRange(0, 5000)
+	text, _ := llb.MarshalText()
+	data := []byte(`{"name":"visitors","sketch":` + string(mustJSON(t, llb)) + `,"text":"` + string(text) + `"}`)
+
+	var d doc
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Sketch.Cardinality() != llb.Cardinality() || d.Text.Cardinality() != llb.Cardinality() {
+		t.Errorf("expected %d, got %d and %d", llb.Cardinality(), d.Sketch.Cardinality(), d.Text.Cardinality())
+	}
+
+	// null leaves an existing sketch alone.
+	if err := llb.UnmarshalJSON([]byte("null")); err != nil || llb.Cardinality() == 0 {
+		t.Errorf("null: got %d, %v", llb.Cardinality(), err)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestJSONErrors(t *testing.T) {
+	data := mustJSON(t, buildRange(0, 100))
+
+	p10, _ := NewWithPrecision(10)
+	if err := p10.UnmarshalJSON(data); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+	if err := New(WithHasherXXHash()).UnmarshalJSON(data); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	text, _ := New(WithHasherXXHash()).MarshalText()
+	if !strings.HasPrefix(string(text), "xxhash:") {
+		t.Errorf("expected the hash name as prefix, got %.20s", text)
+	}
+	if err := New().UnmarshalText(text); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+
+	var ie *IncompatibleError
+	future := bytes.Replace(data, []byte(`"version":1`), []byte(`"version":9`), 1)
+	if err := new(LogLogBeta).UnmarshalJSON(future); !errors.As(err, &ie) || ie.Err != ErrVersionUnsupported {
+		t.Errorf("expected an unsupported version, got %v", err)
+	}
+	lying := bytes.Replace(data, []byte(`"precision":14`), []byte(`"precision":12`), 1)
+	if err := new(LogLogBeta).UnmarshalJSON(lying); err == nil {
+		t.Error("expected an error for a precision that doesn't match the registers")
+	}
+	for _, bad := range []string{`{`, `"not base64!"`, `"` + "TExCQw==" + `"`, `[]`} {
+		if err := new(LogLogBeta).UnmarshalJSON([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
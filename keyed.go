@@ -0,0 +1,85 @@
+package loglogbeta
+
+import "sort"
+
+// KeyedSketch pairs a sketch with the key it belongs to.
+type KeyedSketch struct {
+	Key    string
+	Sketch *LogLogBeta
+}
+
+// MergeByKey groups entries by key and returns the union of each group.
+// Entries sharing a key, for example the same key from different shards, are
+// merged into a single sketch; distinct keys stay separate. The input
+// sketches are never modified: every returned sketch is a new one. Entries
+// with a nil Sketch are ignored. Entries sharing a key must have the same
+// precision; MergeByKey panics otherwise.
+func MergeByKey(entries []KeyedSketch) map[string]*LogLogBeta {
+	out := make(map[string]*LogLogBeta)
+	for _, e := range entries {
+		if e.Sketch == nil {
+			continue
+		}
+		if acc, ok := out[e.Key]; ok {
+			acc.mustMerge(e.Sketch)
+		} else {
+			out[e.Key] = e.Sketch.Clone()
+		}
+	}
+	return out
+}
+
+// TrackedUnion returns the union of the named sketches together with, for
+// every name, the number of registers whose final value came from that
+// source. A register held at its maximum by several sources is credited to
+// the first of them in sorted name order, and registers that are zero in
+// every source are credited to none, so the counts add up to the number of
+// non-zero registers in the union. Nil sketches are credited 0. The inputs
+// are never modified. They must all have the same precision, or
+// TrackedUnion panics.
+func TrackedUnion(named map[string]*LogLogBeta) (*LogLogBeta, map[string]int) {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	union := New()
+	for _, name := range names {
+		if s := named[name]; s != nil {
+			union = s.newLike()
+			break
+		}
+	}
+	winner := make([]int, union.numRegisters())
+	for i := range winner {
+		winner[i] = -1
+	}
+	for w, name := range names {
+		s := named[name]
+		if s == nil {
+			continue
+		}
+		if err := union.checkMergeable(s); err != nil {
+			panic(err)
+		}
+		for i, n := uint64(0), uint64(union.numRegisters()); i < n; i++ {
+			if v := s.reg(i); v > union.reg(i) {
+				union.setRegister(i, v)
+				winner[i] = w
+			}
+		}
+		union.mergeMetadata(s)
+	}
+
+	won := make(map[string]int, len(names))
+	for _, name := range names {
+		won[name] = 0
+	}
+	for _, w := range winner {
+		if w >= 0 {
+			won[names[w]]++
+		}
+	}
+	return union, won
+}
@@ -0,0 +1,74 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMergeByKey(t *testing.T) {
+	a1, a2 := buildRange(0, 1000), buildRange(500, 2000)
+	b := buildRange(5000, 6000)
+	a1Regs := append([]uint8(nil), a1.registers...)
+
+	got := MergeByKey([]KeyedSketch{
+		{"a", a1},
+		{"b", b},
+		{"a", a2},
+		{"c", nil},
+	})
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(got))
+	}
+	if exp := buildRange(0, 2000); !bytes.Equal(got["a"].registers, exp.registers) {
+		t.Error("key a: registers differ from the union of its entries")
+	}
+	if !bytes.Equal(got["b"].registers, b.registers) {
+		t.Error("key b: registers differ from its only entry")
+	}
+	if got["b"] == b {
+		t.Error("key b: expected a copy, got the input sketch")
+	}
+	if !bytes.Equal(a1.registers, a1Regs) {
+		t.Error("MergeByKey modified an input sketch")
+	}
+
+	if got := MergeByKey(nil); len(got) != 0 {
+		t.Errorf("no entries: expected empty map, got %d keys", len(got))
+	}
+}
+
+func TestTrackedUnion(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(90000, 100000) // a subset of a
+	c := buildRange(200000, 210000)
+	regs := append([]uint8(nil), b.registers...)
+
+	union, won := TrackedUnion(map[string]*LogLogBeta{"a": a, "b": b, "c": c, "nil": nil})
+	exp := a.Plus(c)
+	if !bytes.Equal(union.registers, exp.registers) {
+		t.Error("union differs from merging the sources")
+	}
+	checkHist(t, "TrackedUnion", union)
+	if !bytes.Equal(b.registers, regs) {
+		t.Error("TrackedUnion modified its input")
+	}
+
+	// b never exceeds a, and "a" sorts first, so b wins nothing.
+	if won["b"] != 0 || won["nil"] != 0 {
+		t.Errorf("expected no wins for b and nil, got %v", won)
+	}
+	if won["a"] == 0 || won["c"] == 0 {
+		t.Errorf("expected wins for a and c, got %v", won)
+	}
+	_, ez := regSumAndZeros(union.registers)
+	if total := won["a"] + won["c"]; total != len(union.registers)-int(ez) {
+		t.Errorf("wins add up to %d, expected %d non-zero registers", total, len(union.registers)-int(ez))
+	}
+
+	// Identical sources tie everywhere; the first name takes every register.
+	_, won = TrackedUnion(map[string]*LogLogBeta{"y": c, "x": c.Clone()})
+	if won["y"] != 0 || won["x"] == 0 {
+		t.Errorf("ties: expected x to win everything, got %v", won)
+	}
+}
@@ -1,9 +1,17 @@
 package loglogbeta
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"log"
 	"math"
 	"math/rand"
+	"strconv"
 	"testing"
+	"unsafe"
 )
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -28,12 +36,61 @@ func TestZeros(t *testing.T) {
 		}
 		registers[i] = val
 	}
-	_, got := regSumAndZeros(registers)
+	_, got := regSumAndZeros(registers[:])
 	if got != exp {
 		t.Errorf("expected %.2f, got %.2f", exp, got)
 	}
 }
 
+func TestHistogramAdd(t *testing.T) {
+	registers := make([]uint8, 1000)
+	for i := range registers {
+		registers[i] = uint8(rand.Intn(len(histogram{})))
+	}
+	// Lengths around the unrolled stride exercise the tail loop.
+	for _, n := range []int{0, 1, 7, 8, 9, 15, 16, 17, 999, 1000} {
+		var exp, got histogram
+		for _, val := range registers[:n] {
+			exp[val]++
+		}
+		got.add(registers[:n])
+		if got != exp {
+			t.Errorf("%d registers: counts differ", n)
+		}
+
+		sum := 0.0
+		for _, val := range registers[:n] {
+			sum += math.Pow(2, -float64(val))
+		}
+		if s, _ := got.sumAndZeros(); math.Abs(s-sum) > 1e-12*sum {
+			t.Errorf("%d registers: expected sum %g, got %g", n, sum, s)
+		}
+	}
+}
+
+// The register counts are sized for the ranks a 64-bit hash can produce, so
+// they don't dominate the footprint of small sparse or packed sketches, and
+// registers beyond that range are rejected before they could be counted.
+func TestHistogramSize(t *testing.T) {
+	if size := unsafe.Sizeof(LogLogBeta{}); size > 512 {
+		t.Errorf("a LogLogBeta takes %d bytes, expected at most 512", size)
+	}
+
+	regs := make([]uint8, m)
+	regs[7] = maxRank + 1
+	if _, err := WrapRegisters(regs); err == nil {
+		t.Error("WrapRegisters: expected an error for a register above the rank cap")
+	}
+	// Without a checksum the corruption goes unnoticed until the registers.
+	blob := New().marshalCompact(false)
+	blob = blob[:len(blob)-4]
+	blob[6] = 0
+	blob[CompactHeaderSize+7] = 200
+	if err := New().UnmarshalCompact(blob); err == nil {
+		t.Error("UnmarshalCompact: expected an error for a register above the rank cap")
+	}
+}
+
 func RandStringBytesMaskImprSrc(n uint32) string {
 	b := make([]byte, n)
 	for i := uint32(0); i < n; i++ {
@@ -101,3 +158,1027 @@ func TestMerge(t *testing.T) {
 		t.Errorf("Exact %d, got %d which is %.2f%% error", exact, res, ratio)
 	}
 }
+
+func TestUnmarshalUnsupportedVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(savedLLB{Version: version + 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := New().UnmarshalBinary(buf.Bytes())
+	if !errors.Is(err, ErrVersionUnsupported) {
+		t.Fatalf("expected ErrVersionUnsupported, got %v", err)
+	}
+	var ie *IncompatibleError
+	if !errors.As(err, &ie) || ie.Got != version+1 || ie.Want != version {
+		t.Errorf("unexpected error details: %#v", ie)
+	}
+}
+
+func TestNewWithPrecision(t *testing.T) {
+	for _, p := range []uint8{0, MinPrecision - 1, MaxPrecision + 1} {
+		if _, err := NewWithPrecision(p); !errors.Is(err, ErrInvalidPrecision) {
+			t.Errorf("precision %d: expected ErrInvalidPrecision, got %v", p, err)
+		}
+	}
+
+	llb, err := NewWithPrecision(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if llb.Precision() != 10 || llb.RegisterBytes() != 1<<10 || llb.alpha != alpha(1<<10) {
+		t.Fatalf("unexpected sketch: precision %d, %d bytes", llb.Precision(), llb.RegisterBytes())
+	}
+	for i := 0; i < 5000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+	checkHist(t, "precision 10", llb)
+
+	before := append([]uint8(nil), llb.registers...)
+	if err := llb.Merge(buildRange(0, 100)); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch, got %v", err)
+	}
+	if !bytes.Equal(llb.registers, before) {
+		t.Error("a rejected merge changed the registers")
+	}
+
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got LogLogBeta
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Precision() != 10 || !bytes.Equal(got.registers, llb.registers) || got.Cardinality() != llb.Cardinality() {
+		t.Error("round trip at precision 10 lost state")
+	}
+	if err := New().UnmarshalBinary(data); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch decoding into the default precision, got %v", err)
+	}
+
+	// Blobs of the default precision keep the version 4 layout.
+	src := buildRange(0, 1000)
+	legacy := struct {
+		Registers [m]uint8
+		Version   int
+		Checksum  uint32
+	}{Version: 4, Checksum: crc32.ChecksumIEEE(src.registers)}
+	copy(legacy.Registers[:], src.registers)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewWithPrecision(precision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.UnmarshalBinary(buf.Bytes()); err != nil || !bytes.Equal(dec.registers, src.registers) {
+		t.Errorf("version 4 blob: %v", err)
+	}
+}
+
+func TestWithPrecision(t *testing.T) {
+	exp, _ := NewWithPrecision(10)
+	for i := 0; i < 3000; i++ {
+		exp.Add([]byte(strconv.Itoa(i)))
+	}
+	// The option resizes whatever layout the other options chose, whichever
+	// comes first.
+	for name, opts := range map[string][]Option{
+		"alone":         {WithPrecision(10)},
+		"before sparse": {WithPrecision(10), WithSparseRegisters()},
+		"after sparse":  {WithSparseRegisters(), WithPrecision(10)},
+		"after packed":  {WithPackedRegisters(), WithPrecision(10)},
+		"after ages":    {WithRegisterAges(), WithPrecision(10)},
+		"overridden":    {WithPrecision(16), WithPrecision(10)},
+	} {
+		llb := New(opts...)
+		if llb.Precision() != 10 || llb.numRegisters() != 1<<10 || llb.alpha != alpha(1<<10) {
+			t.Errorf("%s: precision %d with %d registers", name, llb.Precision(), llb.numRegisters())
+			continue
+		}
+		if llb.ages != nil && len(llb.ages) != 1<<10 {
+			t.Errorf("%s: %d register ages", name, len(llb.ages))
+		}
+		for i := 0; i < 3000; i++ {
+			llb.Add([]byte(strconv.Itoa(i)))
+		}
+		checkHist(t, name, llb)
+		if !bytes.Equal(llb.dense(), exp.registers) {
+			t.Errorf("%s: registers differ from NewWithPrecision", name)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an invalid precision")
+		}
+	}()
+	WithPrecision(MaxPrecision + 1)
+}
+
+func TestRegisterBytes(t *testing.T) {
+	if got := New().RegisterBytes(); got != 1<<precision {
+		t.Errorf("expected %d, got %d", 1<<precision, got)
+	}
+}
+
+func TestScaledCardinality(t *testing.T) {
+	llb := New()
+	for i := 0; i < 10000; i++ {
+		llb.Add([]byte(RandStringBytesMaskImprSrc(16)))
+	}
+
+	est := llb.estimate()
+	cases := []struct {
+		factor float64
+		exp    uint64
+	}{
+		{1, uint64(est)},
+		{4, uint64(est * 4)},
+		{0.5, uint64(est * 0.5)},
+		{0, 0},
+		{-1, 0},
+		{math.NaN(), 0},
+		{math.Inf(1), math.MaxUint64},
+	}
+	for _, c := range cases {
+		if got := llb.ScaledCardinality(c.factor); got != c.exp {
+			t.Errorf("factor %v: expected %d, got %d", c.factor, c.exp, got)
+		}
+	}
+	if llb.CardinalityFloat() != est {
+		t.Error("ScaledCardinality changed the raw estimate")
+	}
+}
+
+func TestGobEmbedded(t *testing.T) {
+	type byPointer struct {
+		Name   string
+		Sketch *LogLogBeta
+	}
+	type byValue struct {
+		Name   string
+		Sketch LogLogBeta
+	}
+	type byInterface struct {
+		Name   string
+		Sketch interface{}
+	}
+
+	llb := New()
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(RandStringBytesMaskImprSrc(16)))
+	}
+	exp := llb.Cardinality()
+
+	roundTrip := func(in, out interface{}) {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+			t.Fatalf("%T: encode: %v", in, err)
+		}
+		if err := gob.NewDecoder(&buf).Decode(out); err != nil {
+			t.Fatalf("%T: decode: %v", in, err)
+		}
+	}
+
+	var p byPointer
+	roundTrip(byPointer{"p", llb}, &p)
+	if p.Sketch == nil || p.Sketch.Cardinality() != exp {
+		t.Errorf("pointer field: expected %d", exp)
+	}
+
+	var v byValue
+	roundTrip(&byValue{"v", *llb}, &v)
+	if v.Sketch.Cardinality() != exp {
+		t.Errorf("value field: expected %d, got %d", exp, v.Sketch.Cardinality())
+	}
+
+	var i byInterface
+	roundTrip(byInterface{"i", llb}, &i)
+	if s, ok := i.Sketch.(*LogLogBeta); !ok || s.Cardinality() != exp {
+		t.Errorf("interface field: expected *LogLogBeta with %d, got %#v", exp, i.Sketch)
+	}
+
+	var n byPointer
+	roundTrip(byPointer{"nil", nil}, &n)
+	if n.Sketch != nil {
+		t.Error("nil pointer field: expected nil after decoding")
+	}
+}
+
+func TestMergeIdempotent(t *testing.T) {
+	a := New()
+	for i := 0; i < 50000; i++ {
+		a.Add([]byte(RandStringBytesMaskImprSrc(16)))
+	}
+	regs, card := append([]uint8(nil), a.registers...), a.Cardinality()
+
+	a.Merge(a)
+	if !bytes.Equal(a.registers, regs) || a.Cardinality() != card {
+		t.Error("merging a sketch into itself changed it")
+	}
+
+	b := New()
+	b.Merge(a)
+	b.Merge(a)
+	if !bytes.Equal(b.registers, regs) || b.Cardinality() != card {
+		t.Error("merging the same sketch twice differs from merging it once")
+	}
+}
+
+func TestMergeOverlapping(t *testing.T) {
+	a, b, union := New(), New(), New()
+	for i := 0; i < 60000; i++ {
+		str := []byte(RandStringBytesMaskImprSrc(16))
+		// a takes the first two thirds, b the last two thirds, so the
+		// middle third is shared.
+		if i < 40000 {
+			a.Add(str)
+		}
+		if i >= 20000 {
+			b.Add(str)
+		}
+		union.Add(str)
+	}
+
+	for i := 0; i < 3; i++ {
+		a.Merge(b)
+		if !bytes.Equal(a.registers, union.registers) {
+			t.Fatalf("round %d: merged registers differ from the union", i)
+		}
+		if a.Cardinality() != union.Cardinality() {
+			t.Fatalf("round %d: expected %d, got %d", i, union.Cardinality(), a.Cardinality())
+		}
+	}
+
+	// Merging a subset into its superset must not grow the estimate.
+	sub := New()
+	for i := 0; i < 1000; i++ {
+		sub.Add([]byte(RandStringBytesMaskImprSrc(16)))
+	}
+	card := sub.Cardinality()
+	sub.Merge(New())
+	if sub.Cardinality() != card {
+		t.Errorf("merging an empty sketch changed the estimate from %d to %d", card, sub.Cardinality())
+	}
+	before := union.Cardinality()
+	union.Merge(b)
+	if union.Cardinality() != before {
+		t.Errorf("merging a subset changed the estimate from %d to %d", before, union.Cardinality())
+	}
+}
+
+func TestZeroAllocs(t *testing.T) {
+	llb, other, xx := New(), New(), New(WithHasherXXHash())
+	value := []byte("hello")
+	other.Add([]byte("world"))
+	str := string(value)
+
+	cases := map[string]func(){
+		"Add":              func() { llb.Add(value) },
+		"AddHash":          func() { llb.AddHash(0xdeadbeef) },
+		"AddString":        func() { llb.AddString(str) },
+		"AddUint64":        func() { llb.AddUint64(42) },
+		"AddInt64":         func() { llb.AddInt64(-42) },
+		"AddString/xxhash": func() { xx.AddString(str) },
+		"AddUint64/xxhash": func() { xx.AddUint64(42) },
+		"Merge":            func() { llb.Merge(other) },
+		"Cardinality":      func() { llb.Cardinality() },
+	}
+	for name, fn := range cases {
+		if n := testing.AllocsPerRun(100, fn); n != 0 {
+			t.Errorf("%s: expected 0 allocations, got %.1f", name, n)
+		}
+	}
+}
+
+func TestTypedAdd(t *testing.T) {
+	a, b := New(), New()
+	var buf [8]byte
+	for i := 0; i < 5000; i++ {
+		s := strconv.Itoa(i)
+		a.AddString(s)
+		b.Add([]byte(s))
+
+		binary.LittleEndian.PutUint64(buf[:], uint64(i)*0x9e3779b97f4a7c15)
+		a.AddUint64(uint64(i) * 0x9e3779b97f4a7c15)
+		b.Add(buf[:])
+
+		binary.LittleEndian.PutUint64(buf[:], uint64(-i))
+		a.AddInt64(int64(-i))
+		b.Add(buf[:])
+	}
+	if !bytes.Equal(a.registers, b.registers) {
+		t.Error("typed adds differ from Add of the encoded values")
+	}
+}
+
+// BenchmarkAddConvert is the conversion AddString saves callers.
+func BenchmarkAddConvert(b *testing.B) {
+	llb := New()
+	s := "user-1234567890"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		llb.Add([]byte(s))
+	}
+}
+
+func BenchmarkAddString(b *testing.B) {
+	llb := New()
+	s := "user-1234567890"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		llb.AddString(s)
+	}
+}
+
+func BenchmarkAddUint64(b *testing.B) {
+	llb := New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		llb.AddUint64(uint64(i))
+	}
+}
+
+func benchmarkSketch() *LogLogBeta {
+	llb := New()
+	for i := uint64(0); i < 100000; i++ {
+		llb.AddHash(mix64(i))
+	}
+	return llb
+}
+
+// BenchmarkCardinality reads the estimate from the maintained counts.
+func BenchmarkCardinality(b *testing.B) {
+	llb := benchmarkSketch()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		llb.Cardinality()
+	}
+}
+
+// BenchmarkRegSumAndZeros is the full register scan behind
+// CardinalityParallel and the other paths without maintained counts.
+func BenchmarkRegSumAndZeros(b *testing.B) {
+	regs := benchmarkSketch().registers
+	b.SetBytes(int64(len(regs)))
+	for i := 0; i < b.N; i++ {
+		regSumAndZeros(regs)
+	}
+}
+
+func TestUnmarshalChecksum(t *testing.T) {
+	llb := New()
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(RandStringBytesMaskImprSrc(16)))
+	}
+
+	encode := func(s savedLLB) []byte {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	good, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New().UnmarshalBinary(good); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Flip one register after the checksum was computed.
+	var s savedLLB
+	if err := gob.NewDecoder(bytes.NewReader(good)).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	s.Registers[42]++
+	if err := New().UnmarshalBinary(encode(s)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	// Version 1 blobs predate the checksum and are accepted as is.
+	s.Version, s.Checksum = 1, 0
+	if err := New().UnmarshalBinary(encode(s)); err != nil {
+		t.Errorf("version 1 blob: unexpected error %v", err)
+	}
+}
+
+// fillRegisters spreads data over the registers, repeating it as needed and
+// wrapping values into the range a register can hold.
+func fillRegisters(llb *LogLogBeta, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	for i := range llb.registers {
+		llb.registers[i] = data[i%len(data)] % uint8(llb.rankCap()+1)
+	}
+	llb.recount()
+}
+
+func FuzzMerge(f *testing.F) {
+	f.Add([]byte{}, []byte{})
+	f.Add([]byte{0, 1, 2, 3}, []byte{3, 2, 1, 0})
+	f.Add([]byte{51, 0, 7}, []byte{255})
+
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		x, y := New(), New()
+		fillRegisters(x, a)
+		fillRegisters(y, b)
+		before := append([]uint8(nil), x.registers...)
+
+		x.Merge(y)
+		for i, v := range x.registers {
+			exp := before[i]
+			if y.registers[i] > exp {
+				exp = y.registers[i]
+			}
+			if v != exp {
+				t.Fatalf("register %d: expected %d, got %d", i, exp, v)
+			}
+		}
+	})
+}
+
+func TestWrapRegisters(t *testing.T) {
+	src := buildRange(0, 5000)
+	regs := append([]uint8(nil), src.registers...)
+
+	llb, err := WrapRegisters(regs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if llb.Cardinality() != src.Cardinality() {
+		t.Errorf("expected %d, got %d", src.Cardinality(), llb.Cardinality())
+	}
+	if &llb.registers[0] != &regs[0] {
+		t.Error("WrapRegisters copied the slice")
+	}
+
+	for _, n := range []int{0, int(m) - 1, int(m) + 1} {
+		_, err := WrapRegisters(make([]uint8, n))
+		if !errors.Is(err, ErrPrecisionMismatch) {
+			t.Errorf("len %d: expected ErrPrecisionMismatch, got %v", n, err)
+		}
+	}
+}
+
+func TestZeroRegisterBoundary(t *testing.T) {
+	cases := []struct {
+		zeros int
+		value uint8
+	}{
+		{0, 1},
+		{1, 1},
+		{int(m) / 2, 1},
+		{int(m) - 100, 1},
+		{int(m) - 2, 1},
+		{int(m) - 1, 1},
+		{int(m) - 1, 51},
+		{int(m), 0},
+	}
+
+	prev := uint64(math.MaxUint64)
+	for _, c := range cases {
+		llb := New()
+		for i := c.zeros; i < int(m); i++ {
+			llb.registers[i] = c.value
+		}
+		llb.recount()
+
+		_, ez := regSumAndZeros(llb.registers)
+		if int(ez) != c.zeros {
+			t.Errorf("%d zeros: regSumAndZeros reported %.0f", c.zeros, ez)
+		}
+
+		est := llb.CardinalityFloat()
+		if math.IsNaN(est) || math.IsInf(est, 0) || est < 0 {
+			t.Errorf("%d zeros: estimate %v is not a finite count", c.zeros, est)
+		}
+		got := llb.Cardinality()
+		if c.value == 1 && got > prev {
+			t.Errorf("%d zeros: estimate %d grew from %d as zeros increased", c.zeros, got, prev)
+		}
+		if c.value == 1 {
+			prev = got
+		}
+
+		nonzero := uint64(int(m) - c.zeros)
+		if nonzero <= 2 && got != nonzero {
+			t.Errorf("%d zeros: expected %d, got %d", c.zeros, nonzero, got)
+		}
+	}
+}
+
+func TestSmallCardinality(t *testing.T) {
+	llb := New()
+	for i := 1; i <= 100; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+		if got := llb.Cardinality(); got != uint64(i) {
+			t.Fatalf("after %d adds, got %d", i, got)
+		}
+	}
+}
+
+func TestFillFactor(t *testing.T) {
+	llb := New()
+	if got := llb.FillFactor(); got != 0 {
+		t.Errorf("empty sketch: expected 0, got %v", got)
+	}
+	for i := 0; i < int(m)/4; i++ {
+		llb.registers[i] = 3
+	}
+	llb.recount()
+	if got := llb.FillFactor(); got != 0.25 {
+		t.Errorf("quarter filled: expected 0.25, got %v", got)
+	}
+	llb = buildRange(0, 1000000)
+	if got := llb.FillFactor(); got != 1 {
+		t.Errorf("saturated sketch: expected 1, got %v", got)
+	}
+}
+
+func TestPlus(t *testing.T) {
+	base := buildRange(0, 50000)
+	today := buildRange(40000, 60000)
+	baseRegs := append([]uint8(nil), base.registers...)
+	todayRegs := append([]uint8(nil), today.registers...)
+
+	sum := base.Plus(today)
+	exp := buildRange(0, 60000)
+	if !bytes.Equal(sum.registers, exp.registers) {
+		t.Error("Plus registers differ from the union")
+	}
+	if !bytes.Equal(base.registers, baseRegs) {
+		t.Error("Plus modified the receiver")
+	}
+	if !bytes.Equal(today.registers, todayRegs) {
+		t.Error("Plus modified its argument")
+	}
+
+	sum.Add([]byte("extra"))
+	if !bytes.Equal(base.registers, baseRegs) {
+		t.Error("result of Plus shares registers with the receiver")
+	}
+}
+
+func TestAddHashBoundaries(t *testing.T) {
+	const rest = 64 - precision
+	cases := []struct {
+		x   uint64
+		k   uint64
+		val uint8
+	}{
+		{0, 0, maxRank},
+		{math.MaxUint64, uint64(m) - 1, 1},
+		{1, 0, rest},
+		{1 << (rest - 1), 0, 1},
+		{1<<rest - 1, 0, 1},
+		{1 << rest, 1, maxRank},
+		{uint64(m-1) << rest, uint64(m) - 1, maxRank},
+		{1 << 63, uint64(m) / 2, maxRank},
+	}
+	for _, c := range cases {
+		k, val := getPosVal(c.x, precision)
+		if k != c.k || val != c.val {
+			t.Errorf("getPosVal(%#x): expected (%d, %d), got (%d, %d)", c.x, c.k, c.val, k, val)
+		}
+
+		llb := New()
+		llb.AddHash(c.x)
+		for i, v := range llb.registers {
+			exp := uint8(0)
+			if uint64(i) == c.k {
+				exp = c.val
+			}
+			if v != exp {
+				t.Errorf("AddHash(%#x): register %d expected %d, got %d", c.x, i, exp, v)
+			}
+		}
+		if got := llb.Cardinality(); got != 1 {
+			t.Errorf("AddHash(%#x): expected cardinality 1, got %d", c.x, got)
+		}
+	}
+}
+
+func TestCardinalityCapped(t *testing.T) {
+	llb := buildRange(0, 100000)
+	if got := llb.CardinalityCapped(255); got != llb.Cardinality() {
+		t.Errorf("cap 255: expected %d, got %d", llb.Cardinality(), got)
+	}
+	if got := llb.CardinalityCapped(maxRank); got != llb.Cardinality() {
+		t.Errorf("cap %d: expected %d, got %d", maxRank, llb.Cardinality(), got)
+	}
+
+	// A handful of outlier registers barely move the capped estimate.
+	clean := llb.Cardinality()
+	for i := 0; i < 50; i++ {
+		llb.registers[i*7] = 40
+	}
+	llb.recount()
+	if llb.Cardinality() <= clean {
+		t.Fatal("expected outliers to inflate the estimate")
+	}
+	if got := llb.CardinalityCapped(12); estimateError(got, clean) > 0.01 {
+		t.Errorf("capped estimate %d not within 1%% of %d", got, clean)
+	}
+
+	if got := New().CardinalityCapped(0); got != 0 {
+		t.Errorf("empty sketch: expected 0, got %d", got)
+	}
+	if got := llb.CardinalityCapped(0); got != 0 {
+		t.Errorf("cap 0: expected 0, got %d", got)
+	}
+}
+
+func TestCanMerge(t *testing.T) {
+	a, b := New(), buildRange(0, 100)
+	if !CanMerge(a, b) || !CanMerge(b, a) || !CanMerge(a, a) {
+		t.Error("expected sketches of the same precision to be mergeable")
+	}
+	if CanMerge(a, nil) || CanMerge(nil, b) || CanMerge(nil, nil) {
+		t.Error("expected nil sketches not to be mergeable")
+	}
+	short := &LogLogBeta{registers: make([]uint8, m/2), alpha: alpha(float64(m / 2))}
+	if CanMerge(a, short) {
+		t.Error("expected sketches with different register counts not to be mergeable")
+	}
+	if n := testing.AllocsPerRun(100, func() { CanMerge(a, b) }); n != 0 {
+		t.Errorf("expected 0 allocations, got %.1f", n)
+	}
+}
+
+func TestUnmarshalLegacy(t *testing.T) {
+	src := buildRange(0, 20000)
+
+	// A legacy blob carries only the registers: no version, alpha or
+	// checksum.
+	legacy := struct{ Registers [m]uint8 }{}
+	copy(legacy.Registers[:], src.registers)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged []string
+	logf = func(format string, args ...interface{}) {
+		logged = append(logged, format)
+	}
+	defer func() { logf = log.Printf }()
+
+	llb := New()
+	if err := llb.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if llb.alpha != alpha(float64(m)) {
+		t.Errorf("expected recomputed alpha %v, got %v", alpha(float64(m)), llb.alpha)
+	}
+	if llb.Cardinality() != src.Cardinality() {
+		t.Errorf("expected %d, got %d", src.Cardinality(), llb.Cardinality())
+	}
+	if len(logged) != 1 {
+		t.Errorf("expected one log line for the upgrade, got %d", len(logged))
+	}
+
+	// Re-marshalling writes the current version, so the upgrade is silent
+	// on the next load.
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New().UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 {
+		t.Error("current-version blob was reported as legacy")
+	}
+}
+
+// checkHist fails the test if llb's maintained counts disagree with a fresh
+// scan of its registers.
+func checkHist(t *testing.T, name string, llb *LogLogBeta) {
+	t.Helper()
+	var exp histogram
+	exp.add(llb.dense())
+	if llb.hist != exp {
+		t.Errorf("%s: maintained register counts are out of sync", name)
+	}
+}
+
+func TestIncrementalEstimate(t *testing.T) {
+	llb := New()
+	checkHist(t, "New", llb)
+	for i := 0; i < 200000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+		if i%10007 == 0 {
+			checkHist(t, "Add", llb)
+			sum, ez := regSumAndZeros(llb.registers)
+			if got, exp := llb.CardinalityFloat(), llb.estimateFrom(sum, ez); got != exp {
+				t.Fatalf("after %d adds: incremental estimate %v, full scan %v", i+1, got, exp)
+			}
+		}
+	}
+	checkHist(t, "Add", llb)
+
+	other := buildRange(150000, 400000)
+	llb.Merge(other)
+	checkHist(t, "Merge", llb)
+
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := New()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	checkHist(t, "UnmarshalBinary", decoded)
+
+	wrapped, _ := WrapRegisters(append([]uint8(nil), llb.registers...))
+	checkHist(t, "WrapRegisters", wrapped)
+	checkHist(t, "clone", llb.Clone())
+
+	llb.Reset()
+	checkHist(t, "reset", llb)
+	if llb.Cardinality() != 0 {
+		t.Errorf("reset sketch: expected 0, got %d", llb.Cardinality())
+	}
+}
+
+func TestAddHashCapped(t *testing.T) {
+	const limit = 5000
+	llb := New()
+	var firstFalse int
+	for i := 0; i < 20000; i++ {
+		if !llb.AddHashCapped(metroHash([]byte(strconv.Itoa(i))), limit) && firstFalse == 0 {
+			firstFalse = i + 1
+		}
+	}
+	if firstFalse == 0 {
+		t.Fatal("AddHashCapped never reported the limit")
+	}
+	if ratio := 100 * estimateError(uint64(firstFalse), limit); ratio > 3 {
+		t.Errorf("limit %d reported after %d adds (%.2f%% off)", limit, firstFalse, ratio)
+	}
+	if got := llb.Cardinality(); got <= limit || got > limit+10 {
+		t.Errorf("expected the sketch to stop just past the limit, got %d", got)
+	}
+
+	frozen := append([]uint8(nil), llb.registers...)
+	if llb.AddHashCapped(12345, limit) {
+		t.Error("expected false once over the limit")
+	}
+	if !bytes.Equal(llb.registers, frozen) {
+		t.Error("sketch kept growing past the limit")
+	}
+}
+
+func TestLazyClone(t *testing.T) {
+	base := buildRange(0, 50000)
+	regs := append([]uint8(nil), base.registers...)
+
+	fork := base.LazyClone()
+	if &fork.registers[0] != &base.registers[0] {
+		t.Fatal("LazyClone copied the registers up front")
+	}
+	if fork.Cardinality() != base.Cardinality() || fork.FillFactor() != base.FillFactor() {
+		t.Error("lazy clone reads differ from the base")
+	}
+	if &fork.registers[0] != &base.registers[0] {
+		t.Error("reading a lazy clone copied the registers")
+	}
+
+	// Writing the fork copies and leaves the base alone.
+	fork.Merge(buildRange(50000, 100000))
+	if !bytes.Equal(base.registers, regs) {
+		t.Error("writing the lazy clone modified the base")
+	}
+	if estimateError(fork.Cardinality(), 100000) > 0.03 {
+		t.Errorf("fork: expected ~100000, got %d", fork.Cardinality())
+	}
+	checkHist(t, "fork", fork)
+
+	// Writing the base copies and leaves another fork alone.
+	other := base.LazyClone()
+	for i := 100000; i < 110000; i++ {
+		base.Add([]byte(strconv.Itoa(i)))
+	}
+	if !bytes.Equal(other.registers, regs) {
+		t.Error("writing the base modified its lazy clone")
+	}
+	checkHist(t, "base", base)
+	checkHist(t, "other", other)
+
+	// Resetting or decoding into a lazy clone must not zero the shared array.
+	third := other.LazyClone()
+	third.Reset()
+	if !bytes.Equal(other.registers, regs) {
+		t.Error("resetting a lazy clone modified the original")
+	}
+	data, _ := New().MarshalBinary()
+	fourth := other.LazyClone()
+	if err := fourth.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(other.registers, regs) {
+		t.Error("decoding into a lazy clone modified the original")
+	}
+}
+
+func TestEmptyCardinality(t *testing.T) {
+	empty := []*LogLogBeta{New(), New(WithHasherXXHash()), GetSketch()}
+	reset := buildRange(0, 1000)
+	reset.Reset()
+	wrapped, _ := WrapRegisters(make([]uint8, m))
+	empty = append(empty, reset, wrapped, New().Plus(New()))
+
+	for i, llb := range empty {
+		if got := llb.Cardinality(); got != 0 {
+			t.Errorf("sketch %d: expected 0, got %d", i, got)
+		}
+		if got := llb.CardinalityFloat(); got != 0 {
+			t.Errorf("sketch %d: expected 0.0, got %v", i, got)
+		}
+	}
+}
+
+func TestMarshalOmitsDefaultAlpha(t *testing.T) {
+	llb := buildRange(0, 1000)
+	def, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s savedLLB
+	if err := gob.NewDecoder(bytes.NewReader(def)).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Alpha != 0 {
+		t.Errorf("default alpha was stored: %v", s.Alpha)
+	}
+	decoded := New()
+	decoded.alpha = 0.5
+	if err := decoded.UnmarshalBinary(def); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.alpha != alpha(float64(m)) || decoded.Cardinality() != llb.Cardinality() {
+		t.Errorf("alpha not recomputed on load: %v", decoded.alpha)
+	}
+
+	// An overridden alpha is still stored and restored.
+	llb.alpha = 0.7
+	custom, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(custom) <= len(def) {
+		t.Error("expected the overridden alpha to take up space")
+	}
+	decoded = New()
+	if err := decoded.UnmarshalBinary(custom); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.alpha != 0.7 {
+		t.Errorf("expected alpha 0.7, got %v", decoded.alpha)
+	}
+}
+
+func TestEstimateGuards(t *testing.T) {
+	llb := buildRange(0, 10000)
+	sum, ez := llb.hist.sumAndZeros()
+	mf := float64(m)
+
+	cases := []struct {
+		name    string
+		sum, ez float64
+	}{
+		{"negative zeros", sum, -5},
+		{"too many zeros", sum, mf + 10},
+		{"NaN zeros", sum, math.NaN()},
+		{"NaN sum", math.NaN(), ez},
+		{"infinite sum", math.Inf(1), ez},
+		{"negative sum", -mf, ez},
+		{"zero denominator", -beta(ez, precision), ez},
+	}
+	for _, c := range cases {
+		got := llb.estimateFrom(c.sum, c.ez)
+		if math.IsNaN(got) || math.IsInf(got, 0) || got < 0 || got > math.MaxUint64 {
+			t.Errorf("%s: expected a finite, non-negative estimate, got %v", c.name, got)
+		}
+	}
+	if got := llb.estimateFrom(sum, -5); got != llb.estimateFrom(sum, 0) {
+		t.Errorf("negative zeros should clamp to 0, got %v", got)
+	}
+
+	// A corrupted zero count larger than m clamps to an empty estimate.
+	llb.hist[0] = m + 100
+	if got := llb.Cardinality(); got != 0 {
+		t.Errorf("corrupted sketch: expected 0, got %d", got)
+	}
+	if got := llb.CardinalityFloat(); math.IsNaN(got) || math.IsInf(got, 0) {
+		t.Errorf("corrupted sketch: expected a finite estimate, got %v", got)
+	}
+}
+
+func TestSetRegisters(t *testing.T) {
+	llb := buildRange(0, 20000)
+	regs := llb.Registers()
+	regs[0]++
+	if regs[0] == llb.registers[0] {
+		t.Error("Registers didn't return a copy")
+	}
+
+	for name, dst := range map[string]*LogLogBeta{
+		"zero":   {},
+		"sparse": New(WithSparseRegisters()),
+		"packed": New(WithPackedRegisters()),
+	} {
+		if err := dst.SetRegisters(llb.Registers()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(dst.Registers(), llb.registers) || dst.Cardinality() != llb.Cardinality() {
+			t.Errorf("%s: registers differ", name)
+		}
+		checkHist(t, name, dst)
+	}
+
+	p10, _ := NewWithPrecision(10)
+	for name, regs := range map[string][]uint8{
+		"empty":          nil,
+		"not a power":    make([]uint8, 1000),
+		"too small":      make([]uint8, 8),
+		"wrong size":     p10.Registers(),
+		"rank too large": append([]uint8{52}, make([]uint8, m-1)...),
+	} {
+		if err := New().SetRegisters(regs); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := new(LogLogBeta).SetRegisters(p10.Registers()); err != nil {
+		t.Errorf("zero sketch should take on precision 10, got %v", err)
+	}
+}
+
+func TestResetMatchesNew(t *testing.T) {
+	configs := map[string][]Option{
+		"default":    nil,
+		"xxhash":     {WithHasherXXHash()},
+		"sparse":     {WithSparseRegisters()},
+		"packed":     {WithPackedRegisters()},
+		"ages":       {WithRegisterAges()},
+		"uniformity": {WithIndexUniformity()},
+	}
+	for name, opts := range configs {
+		used := New(opts...)
+		for i := 0; i < 50000; i++ {
+			used.Add([]byte(strconv.Itoa(i)))
+		}
+		used.CardinalityDelta()
+		used.Reset()
+		fresh := New(opts...)
+
+		for _, llb := range []*LogLogBeta{used, fresh} {
+			for i := 0; i < 300; i++ {
+				llb.Add([]byte("next" + strconv.Itoa(i)))
+			}
+		}
+		a, _ := used.MarshalBinary()
+		b, _ := fresh.MarshalBinary()
+		if !bytes.Equal(a, b) || used.Cardinality() != fresh.Cardinality() {
+			t.Errorf("%s: reset sketch differs from a new one", name)
+		}
+		if used.adds != fresh.adds || used.calls != fresh.calls || used.CardinalityDelta() != fresh.CardinalityDelta() {
+			t.Errorf("%s: counters didn't start over", name)
+		}
+		checkHist(t, name, used)
+	}
+
+	llb := buildRange(0, 1000)
+	if n := testing.AllocsPerRun(100, llb.Reset); n != 0 {
+		t.Errorf("Reset allocated %.1f times", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	for name, llb := range map[string]*LogLogBeta{
+		"default": buildRange(0, 5000),
+		"sparse":  New(WithSparseRegisters(), WithHasherXXHash()),
+		"packed":  New(WithPackedRegisters()),
+	} {
+		llb.Add([]byte("x"))
+		c := llb.Clone()
+		if !bytes.Equal(c.dense(), llb.dense()) || c.HashID() != llb.HashID() || !CanMerge(c, llb) {
+			t.Errorf("%s: clone differs", name)
+		}
+		before := llb.Cardinality()
+		for i := 0; i < 1000; i++ {
+			c.Add([]byte("more" + strconv.Itoa(i)))
+		}
+		if llb.Cardinality() != before {
+			t.Errorf("%s: writing the clone changed the original", name)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package loglogbeta
+
+// MergeStats counts how the registers of two sketches compared during a
+// MergeWithStats call. Positions where both registers hold the same value,
+// including both zero, count as neither ReceiverWon nor OtherWon.
+type MergeStats struct {
+	// ReceiverWon is the number of positions where the receiver's register
+	// was strictly larger and was kept.
+	ReceiverWon int
+	// OtherWon is the number of positions where the other sketch's register
+	// was strictly larger and replaced the receiver's.
+	OtherWon int
+	// BothNonZero is the number of positions where both registers were
+	// nonzero, whichever won. It is a cheap overlap signal: sketches built
+	// from disjoint, small inputs rarely collide, while sketches of the same
+	// data collide on every occupied register.
+	BothNonZero int
+}
+
+// MergeWithStats merges other into llb exactly like Merge and reports how
+// the registers compared before the merge. If the precisions differ it
+// returns Merge's error and zero stats.
+func (llb *LogLogBeta) MergeWithStats(other *LogLogBeta) (MergeStats, error) {
+	var s MergeStats
+	if err := llb.checkMergeable(other); err != nil {
+		return s, err
+	}
+	for i, n := uint64(0), uint64(llb.numRegisters()); i < n; i++ {
+		v, o := llb.reg(i), other.reg(i)
+		switch {
+		case v > o:
+			s.ReceiverWon++
+		case v < o:
+			s.OtherWon++
+			llb.setRegister(i, o)
+		}
+		if v != 0 && o != 0 {
+			s.BothNonZero++
+		}
+	}
+	llb.mergeMetadata(other)
+	return s, nil
+}
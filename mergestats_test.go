@@ -0,0 +1,58 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMergeWithStats(t *testing.T) {
+	a := buildRange(0, 20000)
+	b := buildRange(10000, 30000)
+
+	var receiver, other, both int
+	for i, v := range a.registers {
+		o := b.registers[i]
+		if v > o {
+			receiver++
+		}
+		if o > v {
+			other++
+		}
+		if v != 0 && o != 0 {
+			both++
+		}
+	}
+
+	exp := a.Plus(b)
+	s, err := a.MergeWithStats(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.registers, exp.registers) {
+		t.Error("registers differ from Merge")
+	}
+	checkHist(t, "MergeWithStats", a)
+	if s.ReceiverWon != receiver || s.OtherWon != other || s.BothNonZero != both {
+		t.Errorf("expected {%d %d %d}, got %+v", receiver, other, both, s)
+	}
+
+	// Merging a sketch into a copy of itself collides everywhere and changes
+	// nothing.
+	c := buildRange(0, 1000)
+	_, ez := regSumAndZeros(c.registers)
+	s, _ = c.MergeWithStats(c.Clone())
+	if s.ReceiverWon != 0 || s.OtherWon != 0 || s.BothNonZero != len(c.registers)-int(ez) {
+		t.Errorf("self merge: unexpected stats %+v", s)
+	}
+
+	s, _ = New().MergeWithStats(c)
+	if s.OtherWon != len(c.registers)-int(ez) || s.BothNonZero != 0 {
+		t.Errorf("into empty: unexpected stats %+v", s)
+	}
+
+	small, _ := NewWithPrecision(10)
+	if _, err := New().MergeWithStats(small); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected ErrPrecisionMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package loglogbeta
+
+import "time"
+
+// WithMetadata makes the sketch record when it was created and how many
+// hashes have been added to it, and persist both in MarshalBinary output.
+// Without it the serialized form is unchanged. The fixed-size encoding never
+// carries metadata.
+func WithMetadata() Option {
+	return func(llb *LogLogBeta) {
+		llb.meta = true
+		llb.created = time.Now()
+	}
+}
+
+// Metadata returns the creation time and the total number of adds, counting
+// duplicates, of a sketch created WithMetadata. Merging adds the other
+// sketch's total and keeps the earlier creation time. For sketches without
+// metadata it returns the zero time and 0.
+func (llb *LogLogBeta) Metadata() (created time.Time, totalAdds uint64) {
+	if !llb.meta {
+		return time.Time{}, 0
+	}
+	return llb.created, llb.adds
+}
+
+func (llb *LogLogBeta) mergeMetadata(other *LogLogBeta) {
+	llb.adds += other.adds
+	if other.meta && (!llb.meta || other.created.Before(llb.created)) {
+		llb.created = other.created
+	}
+}
@@ -0,0 +1,67 @@
+package loglogbeta
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	before := time.Now()
+	llb := New(WithMetadata())
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(strconv.Itoa(i % 100)))
+	}
+
+	created, adds := llb.Metadata()
+	if created.Before(before) || created.After(time.Now()) {
+		t.Errorf("unexpected creation time %v", created)
+	}
+	if adds != 1000 {
+		t.Errorf("expected 1000 adds, got %d", adds)
+	}
+
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := New()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	gotCreated, gotAdds := decoded.Metadata()
+	if !gotCreated.Equal(created) || gotAdds != adds {
+		t.Errorf("expected (%v, %d) after round trip, got (%v, %d)", created, adds, gotCreated, gotAdds)
+	}
+
+	older := New(WithMetadata())
+	older.created = created.Add(-time.Hour)
+	older.Add([]byte("x"))
+	llb.Merge(older)
+	if c, n := llb.Metadata(); !c.Equal(older.created) || n != 1001 {
+		t.Errorf("after merge: expected (%v, 1001), got (%v, %d)", older.created, c, n)
+	}
+}
+
+func TestMetadataDisabled(t *testing.T) {
+	plain := buildRange(0, 1000)
+	if c, n := plain.Metadata(); !c.IsZero() || n != 0 {
+		t.Errorf("expected no metadata, got (%v, %d)", c, n)
+	}
+
+	withMeta := New(WithMetadata())
+	withMeta.Merge(plain)
+	a, _ := plain.MarshalBinary()
+	b, _ := withMeta.MarshalBinary()
+	if len(b) <= len(a) {
+		t.Error("expected metadata to be serialized")
+	}
+
+	decoded := New()
+	if err := decoded.UnmarshalBinary(a); err != nil {
+		t.Fatal(err)
+	}
+	if c, n := decoded.Metadata(); !c.IsZero() || n != 0 {
+		t.Errorf("decoded plain sketch has metadata (%v, %d)", c, n)
+	}
+}
@@ -0,0 +1,83 @@
+package loglogbeta
+
+// maxPacked is the largest register value the 4-bit packed storage holds.
+const maxPacked = 0x0f
+
+// WithPackedRegisters stores the registers four bits each, two to a byte,
+// halving the memory of a sketch while every register is at most 15. Each
+// distinct element needs a larger value with probability 2^-15, whatever
+// the precision, so a sketch stays packed for about 32,000 elements on
+// average: half of all sketches are promoted before some 23,000 elements and
+// one in ten before 3,500, while one in ten lasts beyond 75,000. It suits
+// the small sketches of a large collection rather than single big ones.
+// The first write of a larger value transparently promotes the sketch to
+// one byte per register; it is never packed again. The promotion is the one
+// write that allocates.
+//
+// Add, Merge and Cardinality behave exactly as for a regular sketch. Methods
+// that export the whole register array, such as MarshalBinary or WriteCSV,
+// unpack a temporary copy, and decoding a blob into a packed sketch leaves
+// it unpacked. It replaces WithSparseRegisters if both are given.
+func WithPackedRegisters() Option {
+	return func(llb *LogLogBeta) {
+		n := 1 << llb.p
+		llb.registers = nil
+		llb.sparse, llb.entries = false, nil
+		llb.packed = make([]uint8, (n+1)/2)
+		llb.hist = histogram{}
+		llb.hist[0] = uint32(n)
+	}
+}
+
+// numRegisters returns the number of registers, whichever way they are
+// stored.
+func (llb *LogLogBeta) numRegisters() int {
+	if llb.sparse {
+		return 1 << llb.p
+	}
+	if llb.packed != nil {
+		return 2 * len(llb.packed)
+	}
+	return len(llb.registers)
+}
+
+// reg returns the value of register k.
+func (llb *LogLogBeta) reg(k uint64) uint8 {
+	if llb.sparse {
+		if i, ok := llb.sparseFind(k); ok {
+			return uint8(llb.entries[i])
+		}
+		return 0
+	}
+	if llb.packed != nil {
+		return llb.packed[k/2] >> (4 * (k % 2)) & maxPacked
+	}
+	return llb.registers[k]
+}
+
+// dense returns the registers one byte each. For a packed or sparse sketch
+// it is a fresh copy, so callers must only read it.
+func (llb *LogLogBeta) dense() []uint8 {
+	if llb.sparse {
+		regs := make([]uint8, llb.numRegisters())
+		for _, e := range llb.entries {
+			regs[e>>8] = uint8(e)
+		}
+		return regs
+	}
+	if llb.packed == nil {
+		return llb.registers
+	}
+	regs := make([]uint8, llb.numRegisters())
+	for i, b := range llb.packed {
+		regs[2*i] = b & maxPacked
+		regs[2*i+1] = b >> 4
+	}
+	return regs
+}
+
+// unpack switches a packed sketch to one byte per register.
+func (llb *LogLogBeta) unpack() {
+	llb.registers = llb.dense()
+	llb.packed = nil
+}
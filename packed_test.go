@@ -0,0 +1,116 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestPackedRegisters(t *testing.T) {
+	llb := New(WithPackedRegisters())
+	exp := New()
+	if llb.RegisterBytes() != int(m)/2 {
+		t.Errorf("expected %d register bytes, got %d", m/2, llb.RegisterBytes())
+	}
+
+	// Hashes whose rank stays below 16 keep the sketch packed.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		x := rng.Uint64() | 1<<(max-maxPacked)
+		llb.AddHash(x)
+		exp.AddHash(x)
+	}
+	if llb.packed == nil {
+		t.Fatal("sketch was unpacked by small register values")
+	}
+	if !bytes.Equal(llb.dense(), exp.registers) {
+		t.Error("packed registers differ from the regular sketch")
+	}
+	checkHist(t, "packed", llb)
+	if llb.Cardinality() != exp.Cardinality() {
+		t.Errorf("expected cardinality %d, got %d", exp.Cardinality(), llb.Cardinality())
+	}
+	if llb.Fingerprint() != exp.Fingerprint() {
+		t.Error("fingerprints differ")
+	}
+
+	// Merging into and from packed sketches, including the lazy clone path.
+	other := buildRange(0, 3000)
+	orig := llb.dense()
+	fork := llb.LazyClone()
+	fork.Merge(other)
+	exp.Merge(other)
+	if !bytes.Equal(fork.dense(), exp.registers) {
+		t.Error("merge into packed sketch differs")
+	}
+	checkHist(t, "merged", fork)
+	if !bytes.Equal(llb.dense(), orig) {
+		t.Error("merging into a lazy clone changed the original")
+	}
+	into := buildRange(0, 3000)
+	into.Merge(fork)
+	if !bytes.Equal(into.registers, exp.registers) {
+		t.Error("merge from packed sketch differs")
+	}
+
+	// A rank above 15 promotes the sketch without losing registers.
+	before := llb.dense()
+	llb.AddHash(0)
+	if llb.packed != nil {
+		t.Fatal("sketch wasn't promoted by a large register value")
+	}
+	before[0] = maxRank
+	if !bytes.Equal(llb.registers, before) {
+		t.Error("promotion lost register values")
+	}
+	checkHist(t, "promoted", llb)
+
+	data, err := fork.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := New()
+	if err := dec.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.registers, exp.registers) {
+		t.Error("round trip of packed sketch differs")
+	}
+
+	fork.Reset()
+	if fork.Cardinality() != 0 || fork.packed == nil {
+		t.Error("reset should leave an empty packed sketch")
+	}
+}
+
+// With unforced hashes the sketch is promoted exactly at the first rank
+// above 15, which arrives after about 2^15 distinct elements on average.
+func TestPackedPromotion(t *testing.T) {
+	const seeds = 40
+	var at []int
+	for seed := int64(0); seed < seeds; seed++ {
+		llb := New(WithPackedRegisters())
+		rng := rand.New(rand.NewSource(seed))
+		for i := 1; ; i++ {
+			x := rng.Uint64()
+			_, val := getPosVal(x, precision)
+			llb.AddHash(x)
+			if (llb.packed == nil) != (val > maxPacked) {
+				t.Fatalf("seed %d: add %d with rank %d: packed=%v", seed, i, val, llb.packed != nil)
+			}
+			if llb.packed == nil {
+				at = append(at, i)
+				break
+			}
+		}
+	}
+	sum := 0
+	for _, n := range at {
+		sum += n
+	}
+	// The mean of 40 geometric draws with mean 32768 is within a factor of
+	// 1.6 of it with overwhelming probability.
+	if mean := sum / seeds; mean < 20000 || mean > 52000 {
+		t.Errorf("mean promotion after %d adds, expected about 32768 (%v)", mean, at)
+	}
+}
@@ -0,0 +1,53 @@
+package loglogbeta
+
+import (
+	"math"
+	"sync"
+)
+
+// minParallelChunk is the smallest number of registers worth handing to a
+// separate goroutine.
+const minParallelChunk = 4096
+
+// CardinalityParallel returns the same estimate as Cardinality, but computes
+// it from a fresh scan of the registers using up to workers goroutines
+// instead of the counts the sketch maintains as it is updated. With workers
+// <= 1, or when the array is too small to split, the scan runs serially.
+func (llb *LogLogBeta) CardinalityParallel(workers int) uint64 {
+	regs := llb.dense()
+	n := len(regs)
+	if limit := n / minParallelChunk; workers > limit {
+		workers = limit
+	}
+	if workers <= 1 {
+		sum, ez := regSumAndZeros(regs)
+		return toUint64(math.Round(llb.estimateFrom(sum, ez)))
+	}
+
+	// Each worker fills its own histogram; adding them up is exact, so the
+	// result matches the serial scan bit for bit.
+	parts := make([]histogram, workers)
+	chunk := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := w*chunk, (w+1)*chunk
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(h *histogram, regs []uint8) {
+			defer wg.Done()
+			h.add(regs)
+		}(&parts[w], regs[lo:hi])
+	}
+	wg.Wait()
+
+	var total histogram
+	for i := range parts {
+		for val, c := range parts[i] {
+			total[val] += c
+		}
+	}
+	sum, ez := total.sumAndZeros()
+	return toUint64(math.Round(llb.estimateFrom(sum, ez)))
+}
@@ -0,0 +1,15 @@
+package loglogbeta
+
+import "testing"
+
+func TestCardinalityParallel(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 100000, 1000000} {
+		llb := buildRange(0, n)
+		exp := llb.CardinalityFloat()
+		for _, workers := range []int{-1, 0, 1, 2, 3, 4, 16, 1000} {
+			if got := llb.CardinalityParallel(workers); got != llb.Cardinality() {
+				t.Errorf("n=%d workers=%d: expected %d, got %d (%.4f)", n, workers, llb.Cardinality(), got, exp)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package loglogbeta
+
+import "sync"
+
+var sketchPool = sync.Pool{
+	New: func() interface{} { return New() },
+}
+
+// GetSketch returns an empty sketch with the default configuration, reusing
+// one previously handed to PutSketch when possible. It is equivalent to New
+// but avoids allocating a fresh register array.
+func GetSketch() *LogLogBeta {
+	return sketchPool.Get().(*LogLogBeta)
+}
+
+// PutSketch resets llb and returns it to the pool used by GetSketch. The
+// caller must not use llb, or any slice obtained from it, after the call: it
+// may be handed out again at any time. Sketches with a non-default precision
+// or any of the optional diagnostics enabled are dropped rather than pooled.
+func PutSketch(llb *LogLogBeta) {
+	if llb == nil || llb.packed != nil || llb.ages != nil || llb.bins != nil ||
+		len(llb.registers) != int(m) {
+		return
+	}
+	llb.meta, llb.quota = false, 0
+	llb.Reset()
+	llb.alpha = alpha(float64(m))
+	llb.hash, llb.hashID = metroHash, ""
+	sketchPool.Put(llb)
+}
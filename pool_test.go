@@ -0,0 +1,47 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		llb := GetSketch()
+		if got := llb.Cardinality(); got != 0 {
+			t.Fatalf("round %d: pooled sketch not empty, cardinality %d", i, got)
+		}
+		if llb.alpha != alpha(float64(m)) {
+			t.Fatalf("round %d: unexpected alpha %v", i, llb.alpha)
+		}
+		llb.Add([]byte("a"))
+		llb.Add([]byte("b"))
+		if got := llb.Cardinality(); got != 2 {
+			t.Fatalf("round %d: expected 2, got %d", i, got)
+		}
+		PutSketch(llb)
+	}
+
+	xx := New(WithHasherXXHash())
+	xx.Add([]byte("a"))
+	PutSketch(xx)
+	exp := New()
+	exp.Add([]byte("a"))
+	got := GetSketch()
+	got.Add([]byte("a"))
+	if !bytes.Equal(got.registers, exp.registers) {
+		t.Error("pooled sketch kept a non-default hasher")
+	}
+
+	q := New()
+	q.SetQuota(5)
+	for i := 0; i < 100; i++ {
+		q.AddHash(uint64(i) * 0x9e3779b97f4a7c15)
+	}
+	PutSketch(q)
+	if got := GetSketch(); got.quota != 0 {
+		t.Errorf("pooled sketch kept quota %d", got.quota)
+	}
+
+	PutSketch(nil)
+}
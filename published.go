@@ -0,0 +1,64 @@
+package loglogbeta
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PublishedSketch is a sketch for heavy concurrent writes whose readers need
+// consistent estimates without waiting for writers. Writers update a live
+// sketch under a mutex; Publish takes an immutable snapshot of it and swaps
+// it in atomically, and Cardinality only ever reads the latest snapshot.
+// Readers therefore see the state as of the last Publish, never a partially
+// updated one, and don't block or get blocked by Add.
+//
+// Call Publish periodically, for example on a ticker or before each scrape.
+// Until the first Publish readers see an empty sketch.
+type PublishedSketch struct {
+	mu        sync.Mutex
+	live      *LogLogBeta
+	published atomic.Pointer[LogLogBeta]
+}
+
+// NewPublishedSketch returns an empty PublishedSketch whose live sketch is
+// configured with opts.
+func NewPublishedSketch(opts ...Option) *PublishedSketch {
+	p := &PublishedSketch{live: New(opts...)}
+	p.published.Store(p.live.Clone())
+	return p
+}
+
+// Add inserts value into the live sketch.
+func (p *PublishedSketch) Add(value []byte) {
+	p.mu.Lock()
+	p.live.Add(value)
+	p.mu.Unlock()
+}
+
+// AddHash inserts an already hashed value into the live sketch.
+func (p *PublishedSketch) AddHash(x uint64) {
+	p.mu.Lock()
+	p.live.AddHash(x)
+	p.mu.Unlock()
+}
+
+// Publish makes the current state of the live sketch visible to readers.
+// The snapshot shares the live registers until the next write, so
+// publishing a sketch that hasn't changed since the last Publish is cheap.
+func (p *PublishedSketch) Publish() {
+	p.mu.Lock()
+	snap := p.live.LazyClone()
+	p.mu.Unlock()
+	p.published.Store(snap)
+}
+
+// Cardinality returns the estimate of the last published snapshot.
+func (p *PublishedSketch) Cardinality() uint64 {
+	return p.published.Load().Cardinality()
+}
+
+// Snapshot returns the last published snapshot. It is shared with other
+// readers and must not be modified; Clone returns a private copy.
+func (p *PublishedSketch) Snapshot() *LogLogBeta {
+	return p.published.Load()
+}
@@ -0,0 +1,71 @@
+package loglogbeta
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestPublishedSketch(t *testing.T) {
+	p := NewPublishedSketch()
+	for i := 0; i < 1000; i++ {
+		p.Add([]byte(strconv.Itoa(i)))
+	}
+	if got := p.Cardinality(); got != 0 {
+		t.Errorf("before Publish: expected 0, got %d", got)
+	}
+	p.Publish()
+	exp := buildRange(0, 1000)
+	if got := p.Cardinality(); got != exp.Cardinality() {
+		t.Errorf("expected %d, got %d", exp.Cardinality(), got)
+	}
+
+	// Writes after Publish must not leak into the snapshot.
+	snap := p.Snapshot()
+	fp := snap.Fingerprint()
+	for i := 1000; i < 2000; i++ {
+		p.Add([]byte(strconv.Itoa(i)))
+	}
+	if snap.Fingerprint() != fp || p.Cardinality() != exp.Cardinality() {
+		t.Error("unpublished writes changed the snapshot")
+	}
+
+	// Concurrent writers, publisher and readers; run with -race.
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				p.AddHash(uint64(w)<<32 | uint64(i))
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		last := uint64(0)
+		for i := 0; i < 200; i++ {
+			p.Publish()
+			// Elements are only added, so published estimates never drop.
+			if c := p.Cardinality(); c < last {
+				t.Errorf("published estimate went from %d to %d", last, c)
+			} else {
+				last = c
+			}
+		}
+	}()
+	wg.Wait()
+	<-done
+	p.Publish()
+
+	want := buildRange(0, 2000)
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 5000; i++ {
+			want.AddHash(uint64(w)<<32 | uint64(i))
+		}
+	}
+	if p.Snapshot().Fingerprint() != want.Fingerprint() {
+		t.Error("final snapshot differs from adding everything serially")
+	}
+}
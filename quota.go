@@ -0,0 +1,27 @@
+package loglogbeta
+
+// quotaZ is the number of standard errors OverQuota subtracts from the
+// estimate. Three gives a one-sided confidence of about 99.9%.
+const quotaZ = 3
+
+// SetQuota sets the distinct-element limit checked by OverQuota. A limit of
+// 0 removes the quota. The quota is part of the sketch's configuration: it
+// survives a reset but isn't serialized.
+func (llb *LogLogBeta) SetQuota(limit uint64) {
+	llb.quota = limit
+}
+
+// OverQuota reports whether the sketch has confidently exceeded the limit
+// set with SetQuota. Rather than the estimate itself, it compares the lower
+// bound estimate·(1 - 3·EstimatedError()) with the limit, so a sketch whose
+// true cardinality is at the limit is flagged only about once in a thousand
+// times by estimation noise alone. The price is that enforcement triggers a
+// few standard errors, roughly 2-3% at the default precision, after the
+// limit is actually crossed. Without a quota it returns false.
+func (llb *LogLogBeta) OverQuota() bool {
+	if llb.quota == 0 {
+		return false
+	}
+	lower := llb.estimate() * (1 - quotaZ*llb.EstimatedError())
+	return lower > float64(llb.quota)
+}
@@ -0,0 +1,41 @@
+package loglogbeta
+
+import "testing"
+
+func TestOverQuota(t *testing.T) {
+	llb := buildRange(0, 100000)
+	if llb.OverQuota() {
+		t.Error("no quota: expected false")
+	}
+
+	llb.SetQuota(50000)
+	if !llb.OverQuota() {
+		t.Error("well over the quota: expected true")
+	}
+
+	// An estimate just above the limit is within the noise.
+	llb.SetQuota(llb.Cardinality() - 100)
+	if llb.OverQuota() {
+		t.Errorf("estimate %d barely over quota: expected false", llb.Cardinality())
+	}
+
+	llb.SetQuota(200000)
+	if llb.OverQuota() {
+		t.Error("under the quota: expected false")
+	}
+
+	llb.SetQuota(0)
+	if llb.OverQuota() {
+		t.Error("cleared quota: expected false")
+	}
+
+	llb.SetQuota(10)
+	llb.Reset()
+	if llb.OverQuota() {
+		t.Error("empty sketch: expected false")
+	}
+	llb.Merge(buildRange(0, 1000))
+	if !llb.OverQuota() {
+		t.Error("quota should survive reset")
+	}
+}
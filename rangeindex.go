@@ -0,0 +1,96 @@
+package loglogbeta
+
+import "fmt"
+
+// RangeIndex answers distinct-count queries over ranges of consecutive
+// buckets, such as per-minute sketches, without merging every bucket in the
+// range. Besides the buckets it keeps the union of every aligned block of
+// 2, 4, 8, ... buckets, so any range is covered by O(log n) precomputed
+// sketches. The index takes about twice the memory of the buckets alone.
+type RangeIndex struct {
+	// levels[l][j] is the union of buckets j·2^l to (j+1)·2^l - 1. Only
+	// complete blocks are stored.
+	levels [][]*LogLogBeta
+}
+
+// NewRangeIndex returns an empty RangeIndex.
+func NewRangeIndex() *RangeIndex {
+	return &RangeIndex{levels: [][]*LogLogBeta{nil}}
+}
+
+// Len returns the number of buckets in the index.
+func (ri *RangeIndex) Len() int {
+	return len(ri.levels[0])
+}
+
+// Append adds a copy of s as the next bucket and builds the blocks it
+// completes, one merge per level at most. All buckets must share the
+// precision of the first; a sketch of another precision is rejected with
+// Merge's error.
+func (ri *RangeIndex) Append(s *LogLogBeta) error {
+	if ri.Len() > 0 {
+		if err := ri.levels[0][0].checkMergeable(s); err != nil {
+			return err
+		}
+	}
+	ri.levels[0] = append(ri.levels[0], s.Clone())
+	for l := 1; ; l++ {
+		below := ri.levels[l-1]
+		if len(below)%2 != 0 {
+			return nil
+		}
+		if l == len(ri.levels) {
+			ri.levels = append(ri.levels, nil)
+		}
+		n := len(below)
+		ri.levels[l] = append(ri.levels[l], below[n-2].Plus(below[n-1]))
+	}
+}
+
+// Merge merges s into bucket i and every block containing it, for example
+// to update the current minute as its data arrives. It costs one merge per
+// level.
+func (ri *RangeIndex) Merge(i int, s *LogLogBeta) error {
+	if i < 0 || i >= ri.Len() {
+		return fmt.Errorf("loglogbeta: bucket %d out of range [0, %d)", i, ri.Len())
+	}
+	if err := ri.levels[0][i].checkMergeable(s); err != nil {
+		return err
+	}
+	for l := range ri.levels {
+		if j := i >> l; j < len(ri.levels[l]) {
+			ri.levels[l][j].Merge(s)
+		}
+	}
+	return nil
+}
+
+// Union returns a new sketch holding the union of buckets start to end,
+// inclusive.
+func (ri *RangeIndex) Union(start, end int) (*LogLogBeta, error) {
+	if start < 0 || end >= ri.Len() || start > end {
+		return nil, fmt.Errorf("loglogbeta: range [%d, %d] out of range [0, %d)", start, end, ri.Len())
+	}
+	u := ri.levels[0][start].newLike()
+	for i := start; i <= end; {
+		// Take the largest stored block that starts at i and ends within
+		// the range.
+		l := 0
+		for l+1 < len(ri.levels) && i%(2<<l) == 0 && i+(2<<l)-1 <= end && i>>(l+1) < len(ri.levels[l+1]) {
+			l++
+		}
+		u.mustMerge(ri.levels[l][i>>l])
+		i += 1 << l
+	}
+	return u, nil
+}
+
+// Cardinality returns the estimated number of distinct elements in buckets
+// start to end, inclusive.
+func (ri *RangeIndex) Cardinality(start, end int) (uint64, error) {
+	u, err := ri.Union(start, end)
+	if err != nil {
+		return 0, err
+	}
+	return u.Cardinality(), nil
+}
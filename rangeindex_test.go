@@ -0,0 +1,63 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRangeIndex(t *testing.T) {
+	const buckets = 37
+	ri := NewRangeIndex()
+	var raw []*LogLogBeta
+	for i := 0; i < buckets; i++ {
+		s := buildRange(i*500, i*500+1000)
+		raw = append(raw, s)
+		ri.Append(s)
+	}
+	if ri.Len() != buckets {
+		t.Fatalf("expected %d buckets, got %d", buckets, ri.Len())
+	}
+
+	check := func(name string) {
+		t.Helper()
+		for start := 0; start < buckets; start++ {
+			for end := start; end < buckets; end++ {
+				exp := New()
+				for _, s := range raw[start : end+1] {
+					exp.Merge(s)
+				}
+				got, err := ri.Union(start, end)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got.registers, exp.registers) {
+					t.Fatalf("%s: [%d, %d] differs from merging the buckets", name, start, end)
+				}
+			}
+		}
+	}
+	check("built")
+
+	// Update a bucket in the middle and the latest one.
+	for _, i := range []int{13, buckets - 1} {
+		extra := buildRange(100000+i*100, 100000+i*100+100)
+		raw[i] = raw[i].Plus(extra)
+		if err := ri.Merge(i, extra); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("updated")
+
+	u, _ := ri.Union(2, 30)
+	if got, err := ri.Cardinality(2, 30); err != nil || got != u.Cardinality() {
+		t.Errorf("Cardinality: expected %d, got %d, %v", u.Cardinality(), got, err)
+	}
+	for _, r := range [][2]int{{-1, 3}, {3, buckets}, {5, 4}} {
+		if _, err := ri.Union(r[0], r[1]); err == nil {
+			t.Errorf("[%d, %d]: expected error", r[0], r[1])
+		}
+	}
+	if err := ri.Merge(buckets, New()); err == nil {
+		t.Error("Merge out of range: expected error")
+	}
+}
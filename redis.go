@@ -0,0 +1,194 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Layout of a Redis HyperLogLog string, as written by PFADD and read by
+// PFCOUNT and PFMERGE: a 16-byte header, the magic "HYLL", an encoding byte,
+// three unused bytes and a cached cardinality, followed by 2^14 registers,
+// either packed into 6 bits each or as sparse run-length opcodes.
+const (
+	redisPrecision  = 14
+	redisHeaderSize = 16
+	redisBits       = 6
+	redisDenseSize  = redisHeaderSize + (1<<redisPrecision*redisBits+7)/8
+	redisDense      = 0
+	redisSparse     = 1
+	redisSeed       = 0xadc83b19
+)
+
+var redisMagic = [4]byte{'H', 'Y', 'L', 'L'}
+
+var (
+	errRedisShort    = errors.New("loglogbeta: truncated Redis HyperLogLog")
+	errRedisMagic    = errors.New("loglogbeta: not a Redis HyperLogLog")
+	errRedisEncoding = errors.New("loglogbeta: unknown Redis HyperLogLog encoding")
+	errRedisSparse   = errors.New("loglogbeta: corrupt Redis sparse HyperLogLog")
+)
+
+// WithHasherRedis makes Add hash values the way Redis does for PFADD, so
+// that a sketch of the default precision fills the same registers for the
+// same elements as a Redis HyperLogLog and the two can be unioned through
+// ImportRedisHLL and ExportRedisHLL. Redis applies MurmurHash64A with seed
+// 0xadc83b19, takes the register index from the low 14 bits and the rank
+// from the trailing zeros of the rest; the hash is rearranged so that
+// AddHash finds them in the top bits and leading zeros instead. Its hash id
+// is "redis".
+func WithHasherRedis() Option {
+	return func(llb *LogLogBeta) {
+		llb.hash, llb.hashID = redisHash, "redis"
+	}
+}
+
+func redisHash(value []byte) uint64 {
+	return redisRemap(murmur64A(value, redisSeed))
+}
+
+// redisRemap moves the index bits of Redis hash h to the top and reverses
+// the rest, so that their trailing zeros become leading zeros.
+func redisRemap(h uint64) uint64 {
+	const q = 64 - redisPrecision
+	return h&(1<<redisPrecision-1)<<q | bits.Reverse64(h>>redisPrecision)>>redisPrecision
+}
+
+// murmur64A is Austin Appleby's MurmurHash64A, reading blocks little-endian
+// as Redis does on every platform.
+func murmur64A(data []byte, seed uint64) uint64 {
+	const mul, r = 0xc6a4a7935bd1e995, 47
+	h := seed ^ uint64(len(data))*mul
+	for ; len(data) >= 8; data = data[8:] {
+		k := binary.LittleEndian.Uint64(data)
+		k *= mul
+		k ^= k >> r
+		k *= mul
+		h ^= k
+		h *= mul
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= mul
+	}
+	h ^= h >> r
+	h *= mul
+	h ^= h >> r
+	return h
+}
+
+// ImportRedisHLL returns a sketch holding the registers of a Redis
+// HyperLogLog, the value GET returns for a key written by PFADD, in either
+// its dense or its sparse encoding. The sketch has the default precision and
+// uses WithHasherRedis, so elements added to it afterwards land where Redis
+// would put them, and it can be merged with other sketches built that way.
+func ImportRedisHLL(data []byte) (*LogLogBeta, error) {
+	if len(data) < redisHeaderSize {
+		return nil, errRedisShort
+	}
+	if [4]byte{data[0], data[1], data[2], data[3]} != redisMagic {
+		return nil, errRedisMagic
+	}
+
+	regs := make([]uint8, 1<<redisPrecision)
+	body := data[redisHeaderSize:]
+	switch data[4] {
+	case redisDense:
+		if len(data) != redisDenseSize {
+			return nil, errRedisShort
+		}
+		for i := range regs {
+			regs[i] = redisRegister(body, i)
+		}
+	case redisSparse:
+		if err := decodeRedisSparse(body, regs); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errRedisEncoding
+	}
+
+	llb := New(WithHasherRedis())
+	for i, v := range regs {
+		if int(v) > llb.rankCap() {
+			return nil, fmt.Errorf("loglogbeta: Redis register %d holds %d, above the maximum %d", i, v, llb.rankCap())
+		}
+	}
+	if err := llb.load(redisPrecision, regs); err != nil {
+		return nil, err
+	}
+	return llb, nil
+}
+
+// redisRegister returns register i of dense 6-bit registers, packed least
+// significant bit first.
+func redisRegister(body []byte, i int) uint8 {
+	bit := i * redisBits
+	v := uint16(body[bit/8])
+	if bit/8+1 < len(body) {
+		v |= uint16(body[bit/8+1]) << 8
+	}
+	return uint8(v>>(bit%8)) & (1<<redisBits - 1)
+}
+
+// decodeRedisSparse expands the sparse opcodes in body into regs, which they
+// must cover exactly. ZERO (00xxxxxx) and XZERO (01xxxxxx yyyyyyyy) skip
+// runs of empty registers, of up to 64 and 16384; VAL (1vvvvvxx) sets a run
+// of up to four registers to a value of at most 32.
+func decodeRedisSparse(body []byte, regs []uint8) error {
+	i := 0
+	for len(body) > 0 {
+		op := body[0]
+		var n, v int
+		switch {
+		case op&0xc0 == 0x00:
+			n, body = int(op&0x3f)+1, body[1:]
+		case op&0xc0 == 0x40:
+			if len(body) < 2 {
+				return errRedisShort
+			}
+			n, body = (int(op&0x3f)<<8|int(body[1]))+1, body[2:]
+		default:
+			n, v, body = int(op&0x3)+1, int(op>>2&0x1f)+1, body[1:]
+		}
+		if i+n > len(regs) {
+			return errRedisSparse
+		}
+		for end := i + n; i < end; i++ {
+			regs[i] = uint8(v)
+		}
+	}
+	if i != len(regs) {
+		return errRedisSparse
+	}
+	return nil
+}
+
+// ExportRedisHLL returns llb's registers as a dense Redis HyperLogLog, which
+// can be stored with SET and then read with PFCOUNT or combined with PFMERGE.
+// The cached cardinality is marked invalid, so Redis computes its own
+// estimate on first use. Only sketches of the default precision can be
+// exported; others yield an *IncompatibleError wrapping
+// ErrPrecisionMismatch. Unions in Redis only describe the union of the
+// elements if llb was built WithHasherRedis.
+func (llb *LogLogBeta) ExportRedisHLL() ([]byte, error) {
+	if llb.p != redisPrecision {
+		return nil, &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(llb.p), Want: redisPrecision}
+	}
+	data := make([]byte, redisDenseSize)
+	copy(data, redisMagic[:])
+	data[4] = redisDense
+	data[15] = 1 << 7
+	body := data[redisHeaderSize:]
+	for i, v := range llb.dense() {
+		bit := i * redisBits
+		body[bit/8] |= v << (bit % 8)
+		if hi := v >> (8 - bit%8); hi != 0 {
+			body[bit/8+1] |= hi
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,143 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// redisPatLen is hllPatLen from Redis's hyperloglog.c: the register index
+// is the low 14 bits of the hash and the rank the position of the lowest
+// set bit above them, counting from 1, with bit 50 forced on.
+func redisPatLen(h uint64) (uint64, uint8) {
+	index := h & (1<<redisPrecision - 1)
+	h >>= redisPrecision
+	h |= 1 << (64 - redisPrecision)
+	count := uint8(1)
+	for bit := uint64(1); h&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func TestRedisHash(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 100000; i++ {
+		h := rng.Uint64()
+		if i < 64 {
+			// Exercise every rank, up to the cap of an all-zero remainder.
+			h &= ^uint64(0) << uint(i)
+		}
+		wantK, wantVal := redisPatLen(h)
+		if gotK, gotVal := getPosVal(redisRemap(h), redisPrecision); gotK != wantK || gotVal != wantVal {
+			t.Fatalf("hash %#x: got register %d rank %d, Redis uses %d rank %d", h, gotK, gotVal, wantK, wantVal)
+		}
+	}
+	if redisHash([]byte("x")) != redisRemap(murmur64A([]byte("x"), redisSeed)) {
+		t.Error("redisHash doesn't use murmur64A")
+	}
+}
+
+func TestMurmur64A(t *testing.T) {
+	// Every tail length reaches a distinct value, and byte order matters.
+	seen := map[uint64]bool{}
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	for n := 0; n <= 17; n++ {
+		h := murmur64A(data[:n], redisSeed)
+		if seen[h] {
+			t.Errorf("length %d: repeated hash %#x", n, h)
+		}
+		seen[h] = true
+	}
+	if murmur64A([]byte("ab"), 0) == murmur64A([]byte("ba"), 0) {
+		t.Error("hash ignores byte order")
+	}
+	if murmur64A(data, 1) == murmur64A(data, 2) {
+		t.Error("hash ignores the seed")
+	}
+}
+
+func TestRedisRoundTrip(t *testing.T) {
+	llb := New(WithHasherRedis())
+	for i := 0; i < 50000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+	data, err := llb.ExportRedisHLL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 16+12288 || string(data[:5]) != "HYLL\x00" || data[15]&0x80 == 0 {
+		t.Errorf("unexpected header % x", data[:16])
+	}
+
+	got, err := ImportRedisHLL(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.registers, llb.registers) || got.HashID() != "redis" {
+		t.Error("round trip differs")
+	}
+	checkHist(t, "redis", got)
+	if err := got.Merge(llb); err != nil {
+		t.Errorf("expected the import to merge with a Redis-hashed sketch, got %v", err)
+	}
+	if err := New().Merge(got); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch with the default hash, got %v", err)
+	}
+
+	// Every register value survives the 6-bit packing, at every offset.
+	llb = New()
+	for i := range llb.registers {
+		llb.registers[i] = uint8(i % 52)
+	}
+	llb.recount()
+	data, _ = llb.ExportRedisHLL()
+	if got, err := ImportRedisHLL(data); err != nil || !bytes.Equal(got.registers, llb.registers) {
+		t.Errorf("packing: registers differ, %v", err)
+	}
+
+	p10, _ := NewWithPrecision(10)
+	if _, err := p10.ExportRedisHLL(); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+}
+
+func TestImportRedisSparse(t *testing.T) {
+	header := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	sparse := func(ops ...byte) []byte { return append(append([]byte(nil), header...), ops...) }
+
+	// An empty key, as PFADD creates it: one XZERO covering every register.
+	got, err := ImportRedisHLL(sparse(0x7f, 0xff))
+	if err != nil || got.Cardinality() != 0 {
+		t.Fatalf("empty: got %v, %v", got, err)
+	}
+
+	// ZERO 5, VAL 3 x2, VAL 32 x1, XZERO for the rest.
+	got, err = ImportRedisHLL(sparse(0x04, 0x89, 0xfc, 0x7f, 0xf7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]uint8, 1<<redisPrecision)
+	want[5], want[6], want[7] = 3, 3, 32
+	if !bytes.Equal(got.registers, want) {
+		t.Errorf("unexpected registers % x", got.registers[:10])
+	}
+	checkHist(t, "sparse", got)
+
+	for name, data := range map[string][]byte{
+		"short header":  header[:10],
+		"bad magic":     append([]byte("HYLX"), header[4:]...),
+		"bad encoding":  append([]byte("HYLL\x02"), header[5:]...),
+		"short dense":   append([]byte("HYLL\x00"), header[5:]...),
+		"short opcodes": sparse(0x7f),
+		"too few":       sparse(0x7f, 0xfe),
+		"too many":      sparse(0x7f, 0xff, 0x00),
+		"no opcodes":    sparse(),
+	} {
+		if _, err := ImportRedisHLL(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package loglogbeta
+
+import (
+	"fmt"
+	"math"
+)
+
+// RoundMode selects how CardinalityRounded turns the estimate into an integer.
+type RoundMode int
+
+const (
+	// RoundFloor truncates the estimate.
+	RoundFloor RoundMode = 0
+	// RoundNearest rounds the estimate to the nearest integer, matching
+	// Cardinality.
+	RoundNearest RoundMode = -1
+)
+
+// RoundSignificant rounds the estimate to n significant decimal digits, so
+// that the result doesn't imply more precision than the sketch provides. At
+// the default precision the standard error is about 0.8%, so two or three
+// digits are usually all that is meaningful. Values of n below 1 are treated
+// as 1.
+func RoundSignificant(n int) RoundMode {
+	if n < 1 {
+		n = 1
+	}
+	return RoundMode(n)
+}
+
+// CardinalityRounded returns the cardinality estimate rounded according to
+// mode, which must be RoundFloor, RoundNearest or a mode returned by
+// RoundSignificant. It panics for any other mode, such as a negative value
+// other than RoundNearest.
+func (llb *LogLogBeta) CardinalityRounded(mode RoundMode) uint64 {
+	est := llb.estimate()
+	switch {
+	case mode == RoundFloor:
+		return toUint64(est)
+	case mode == RoundNearest:
+		return toUint64(math.Round(est))
+	case mode > 0:
+		return toUint64(roundSignificant(est, int(mode)))
+	}
+	panic(fmt.Sprintf("loglogbeta: CardinalityRounded with unknown RoundMode %d", mode))
+}
+
+func roundSignificant(f float64, n int) float64 {
+	if f == 0 {
+		return 0
+	}
+	digits := int(math.Floor(math.Log10(math.Abs(f)))) + 1
+	scale := math.Pow(10, float64(digits-n))
+	return math.Round(f/scale) * scale
+}
@@ -0,0 +1,59 @@
+package loglogbeta
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRoundSignificant(t *testing.T) {
+	cases := []struct {
+		f   float64
+		n   int
+		exp float64
+	}{
+		{0, 2, 0},
+		{123456, 2, 120000},
+		{125000, 2, 130000},
+		{123456, 3, 123000},
+		{987.6, 1, 1000},
+		{987.6, 6, 987.6},
+		{0.4, 1, 0.4},
+	}
+	for _, c := range cases {
+		if got := roundSignificant(c.f, c.n); math.Abs(got-c.exp) > 1e-9 {
+			t.Errorf("roundSignificant(%v, %d): expected %v, got %v", c.f, c.n, c.exp, got)
+		}
+	}
+}
+
+func TestCardinalityRounded(t *testing.T) {
+	llb := buildRange(0, 12345)
+	est := llb.CardinalityFloat()
+
+	if got := llb.CardinalityRounded(RoundFloor); got != uint64(est) {
+		t.Errorf("RoundFloor: expected %d, got %d", uint64(est), got)
+	}
+	if got := llb.CardinalityRounded(RoundNearest); got != llb.Cardinality() {
+		t.Errorf("RoundNearest: expected %d, got %d", llb.Cardinality(), got)
+	}
+	if got := llb.CardinalityRounded(RoundSignificant(2)); got != uint64(roundSignificant(est, 2)) {
+		t.Errorf("RoundSignificant(2): expected %d, got %d", uint64(roundSignificant(est, 2)), got)
+	}
+	if RoundSignificant(0) != RoundSignificant(1) {
+		t.Error("RoundSignificant(0) should behave like RoundSignificant(1)")
+	}
+	if got := New().CardinalityRounded(RoundSignificant(3)); got != 0 {
+		t.Errorf("empty sketch: expected 0, got %d", got)
+	}
+
+	for _, mode := range []RoundMode{-2, -100} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("mode %d: expected a panic", mode)
+				}
+			}()
+			llb.CardinalityRounded(mode)
+		}()
+	}
+}
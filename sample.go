@@ -0,0 +1,53 @@
+package loglogbeta
+
+import "math"
+
+// AddHashIf adds x only if pred(x) is true and reports whether it did.
+func (llb *LogLogBeta) AddHashIf(x uint64, pred func(uint64) bool) bool {
+	if !pred(x) {
+		return false
+	}
+	llb.AddHash(x)
+	return true
+}
+
+// SampledAdd adds x only if it falls in a deterministic sample covering
+// roughly rate of all hashes, and reports whether it did. The decision
+// depends on nothing but x and rate, so every sketch given the same rate keeps
+// exactly the same hashes: sampled sketches from different shards can be
+// merged, and an element seen by several of them is either in all of their
+// samples or in none.
+//
+// The recipe for sampled counting is to call SampledAdd for every element
+// and read the estimate with ScaledCardinality(1 / rate). To avoid biasing
+// the register ranks, the decision is made on a remix of x rather than on
+// the bits AddHash uses. A rate of 1 or more keeps everything and a rate of 0
+// or less keeps nothing.
+func (llb *LogLogBeta) SampledAdd(x uint64, rate float64) bool {
+	if !inSample(x, rate) {
+		return false
+	}
+	llb.AddHash(x)
+	return true
+}
+
+func inSample(x uint64, rate float64) bool {
+	switch {
+	case rate >= 1:
+		return true
+	case !(rate > 0):
+		return false
+	}
+	return mix64(x) < uint64(rate*math.Exp2(64))
+}
+
+// mix64 is the murmur3 64-bit finalizer. It decorrelates the sampling
+// decision from the index and rank bits of x.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,69 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestAddHashIf(t *testing.T) {
+	llb := New()
+	even := func(x uint64) bool { return x%2 == 0 }
+	if llb.AddHashIf(3, even) {
+		t.Error("odd hash was added")
+	}
+	if llb.Cardinality() != 0 {
+		t.Error("rejected hash changed the sketch")
+	}
+	if !llb.AddHashIf(4, even) || llb.Cardinality() != 1 {
+		t.Error("even hash was not added")
+	}
+}
+
+func TestSampledAdd(t *testing.T) {
+	const n = 400000
+	for _, rate := range []float64{0.01, 0.1, 0.5} {
+		llb := New()
+		kept := 0
+		for i := 0; i < n; i++ {
+			if llb.SampledAdd(metroHash([]byte(strconv.Itoa(i))), rate) {
+				kept++
+			}
+		}
+		if ratio := estimateError(uint64(kept), uint64(rate*n)); ratio > 0.05 {
+			t.Errorf("rate %v: kept %d of %d", rate, kept, n)
+		}
+		if got := llb.ScaledCardinality(1 / rate); estimateError(got, n) > 0.05 {
+			t.Errorf("rate %v: scaled estimate %d, expected ~%d", rate, got, n)
+		}
+	}
+
+	// Shards sampling the same rate keep the same hashes, so their union
+	// equals sampling the whole stream at once.
+	a, b, whole := New(), New(), New()
+	for i := 0; i < 100000; i++ {
+		x := metroHash([]byte(strconv.Itoa(i)))
+		if i%3 == 0 {
+			a.SampledAdd(x, 0.2)
+		} else {
+			b.SampledAdd(x, 0.2)
+		}
+		// Elements seen by both shards must be sampled consistently.
+		if i%10 == 0 {
+			a.SampledAdd(x, 0.2)
+		}
+		whole.SampledAdd(x, 0.2)
+	}
+	a.Merge(b)
+	if !bytes.Equal(a.registers, whole.registers) {
+		t.Error("merged shard samples differ from sampling the whole stream")
+	}
+
+	none := New()
+	if none.SampledAdd(1, 0) || none.SampledAdd(2, -1) {
+		t.Error("rate <= 0 kept a hash")
+	}
+	if !none.SampledAdd(3, 1) || !none.SampledAdd(4, 2) {
+		t.Error("rate >= 1 dropped a hash")
+	}
+}
@@ -0,0 +1,226 @@
+package loglogbeta
+
+import (
+	"math"
+	"sort"
+)
+
+// intersection estimates |a ∩ b| by inclusion-exclusion, clamped to
+// [0, min(|a|, |b|)].
+func intersection(a, b *LogLogBeta) uint64 {
+	n, _ := intersectionAndUnion(a, b)
+	return n
+}
+
+// intersectionAndUnion returns intersection(a, b) along with the |a ∪ b|
+// estimate it was derived from.
+func intersectionAndUnion(a, b *LogLogBeta) (uint64, uint64) {
+	ca, cb := a.Cardinality(), b.Cardinality()
+	cu := a.Plus(b).Cardinality()
+
+	if ca+cb <= cu {
+		return 0, cu
+	}
+	n := ca + cb - cu
+	if n > ca {
+		n = ca
+	}
+	if n > cb {
+		n = cb
+	}
+	return n, cu
+}
+
+// Union returns a new sketch holding the union of a and b, leaving both
+// untouched. It is a.Plus(b) and likewise panics if their precisions
+// differ.
+func Union(a, b *LogLogBeta) *LogLogBeta {
+	return a.Plus(b)
+}
+
+// IntersectionEstimate estimates |llb ∩ other| by inclusion-exclusion,
+// |llb| + |other| - |llb ∪ other|, clamped to [0, min(|llb|, |other|)].
+// Neither sketch is modified. The estimate inherits the error of the union,
+// so an overlap that is small next to the union is very noisy; see
+// MultiIntersection for more than two sets.
+func (llb *LogLogBeta) IntersectionEstimate(other *LogLogBeta) uint64 {
+	return intersection(llb, other)
+}
+
+// JaccardEstimate estimates the Jaccard similarity |llb ∩ other| /
+// |llb ∪ other|, a value in [0, 1], with the intersection estimated as in
+// IntersectionEstimate. Two empty sketches have similarity 0. Neither
+// sketch is modified.
+func (llb *LogLogBeta) JaccardEstimate(other *LogLogBeta) float64 {
+	inter, union := intersectionAndUnion(llb, other)
+	switch {
+	case union == 0:
+		return 0
+	case inter >= union:
+		return 1
+	}
+	return float64(inter) / float64(union)
+}
+
+// ContributionOf estimates how many of the elements counted in total came
+// from source, that is |source ∩ total|. When source was merged into total,
+// source is a subset of total and the result is simply |source|; otherwise
+// it is the inclusion-exclusion intersection |source| + |total| - |source ∪
+// total|, clamped to [0, min(|source|, |total|)]. Neither sketch is modified.
+func ContributionOf(total, source *LogLogBeta) uint64 {
+	return intersection(source, total)
+}
+
+// DifferenceOfUnions estimates |a \ (s1 ∪ s2 ∪ ...)|, the number of elements
+// in a that appear in none of the subtracted sketches, as |a ∪ S| - |S| where
+// S is the union of subtract. The result is clamped to [0, |a|] and none of
+// the inputs are modified. With nothing to subtract it returns |a|. Like
+// the other set operations it panics if the precisions differ.
+func DifferenceOfUnions(a *LogLogBeta, subtract ...*LogLogBeta) uint64 {
+	ca := a.Cardinality()
+	if len(subtract) == 0 {
+		return ca
+	}
+
+	s := subtract[0].Clone()
+	for _, o := range subtract[1:] {
+		s.mustMerge(o)
+	}
+	cs := s.Cardinality()
+	s.mustMerge(a)
+	cu := s.Cardinality()
+
+	if cu <= cs {
+		return 0
+	}
+	if d := cu - cs; d < ca {
+		return d
+	}
+	return ca
+}
+
+// SymmetricDifference estimates |a △ b|, the number of elements in exactly
+// one of the two sets, as |a ∪ b| - |a ∩ b| with the intersection estimated
+// by inclusion-exclusion. The result is clamped to [0, |a ∪ b|] and neither
+// sketch is modified.
+func SymmetricDifference(a, b *LogLogBeta) uint64 {
+	cu := a.Plus(b).Cardinality()
+	inter := intersection(a, b)
+	if inter >= cu {
+		return 0
+	}
+	return cu - inter
+}
+
+// ReachBreakdown returns the cardinality of the union of channels and, for
+// every channel, an estimate of its unique reach: the elements in that
+// channel and in no other, |union| - |union of the others|, clamped to
+// [0, |channel|]. Nil sketches count as empty. None of the inputs are
+// modified, and they must share a precision.
+//
+// Each channel's unique reach is a difference of two large estimates, so
+// its absolute error is that of the union, not of the channel: small
+// channels inside a large union have very noisy values.
+func ReachBreakdown(channels map[string]*LogLogBeta) (total uint64, uniqueByChannel map[string]uint64) {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// suffix[i] is the union of channels names[i:], so the union of all
+	// channels but i is the running prefix union merged with suffix[i+1].
+	empty := New()
+	for _, c := range channels {
+		if c != nil {
+			empty = c.newLike()
+			break
+		}
+	}
+	suffix := make([]*LogLogBeta, len(names)+1)
+	suffix[len(names)] = empty
+	for i := len(names) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1].Clone()
+		if c := channels[names[i]]; c != nil {
+			suffix[i].mustMerge(c)
+		}
+	}
+	total = suffix[0].Cardinality()
+
+	uniqueByChannel = make(map[string]uint64, len(names))
+	prefix := empty.Clone()
+	for i, name := range names {
+		c := channels[name]
+		if c == nil {
+			uniqueByChannel[name] = 0
+			continue
+		}
+		others := prefix.Plus(suffix[i+1]).Cardinality()
+		var u uint64
+		if total > others {
+			u = total - others
+		}
+		if cc := c.Cardinality(); u > cc {
+			u = cc
+		}
+		uniqueByChannel[name] = u
+		prefix.mustMerge(c)
+	}
+	return total, uniqueByChannel
+}
+
+// maxIntersectionSets bounds MultiIntersection, whose cost grows as 2^n.
+const maxIntersectionSets = 12
+
+// MultiIntersection estimates |s1 ∩ s2 ∩ ... ∩ sn| by the full
+// inclusion-exclusion expansion
+//
+//	|∩ si| = Σ over non-empty subsets T of (-1)^(|T|+1) |∪ T|
+//
+// evaluating the union of every one of the 2^n - 1 subsets. The result is
+// clamped to [0, min |si|] and none of the inputs are modified. With a
+// single sketch it returns its cardinality, with none 0. More than 12
+// sketches are rejected by returning 0, since the expansion would take
+// thousands of merges for a meaningless result. The sketches must share a
+// precision.
+//
+// This is a best-effort estimate. Every term carries the sketch's relative
+// error on the cardinality of a union, and the terms largely cancel, so the
+// absolute error is that of the largest unions multiplied by a factor that
+// grows exponentially with n. It is only meaningful for a few sets, three or
+// four, of similar size whose intersection is a large fraction of each.
+func MultiIntersection(sketches ...*LogLogBeta) uint64 {
+	n := len(sketches)
+	if n == 0 || n > maxIntersectionSets {
+		return 0
+	}
+
+	smallest := uint64(math.MaxUint64)
+	for _, s := range sketches {
+		if c := s.Cardinality(); c < smallest {
+			smallest = c
+		}
+	}
+
+	// Walk the subsets depth first, extending the union of the current
+	// subset by one later sketch at a time, so at most n unions are live.
+	sum := 0.0
+	var walk func(start int, union *LogLogBeta, size int)
+	walk = func(start int, union *LogLogBeta, size int) {
+		for i := start; i < n; i++ {
+			u := union.Plus(sketches[i])
+			if size%2 == 0 {
+				sum += u.CardinalityFloat()
+			} else {
+				sum -= u.CardinalityFloat()
+			}
+			walk(i+1, u, size+1)
+		}
+	}
+	walk(0, sketches[0].newLike(), 0)
+
+	if est := toUint64(math.Round(sum)); est < smallest {
+		return est
+	}
+	return smallest
+}
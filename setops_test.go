@@ -0,0 +1,216 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// buildRange returns a sketch holding the integers in [from, to).
+func buildRange(from, to int) *LogLogBeta {
+	llb := New()
+	for i := from; i < to; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+	}
+	return llb
+}
+
+func TestContributionOf(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(100000, 130000)
+	c := buildRange(150000, 200000)
+
+	total := New()
+	for _, s := range []*LogLogBeta{a, b, c} {
+		total.Merge(s)
+	}
+	regs := append([]uint8(nil), total.registers...)
+
+	for i, s := range []*LogLogBeta{a, b, c} {
+		exact := s.Cardinality()
+		got := ContributionOf(total, s)
+		if ratio := 100 * estimateError(got, exact); ratio > 5 {
+			t.Errorf("source %d: expected ~%d, got %d (%.2f%% error)", i, exact, got, ratio)
+		}
+	}
+	if !bytes.Equal(total.registers, regs) {
+		t.Error("ContributionOf modified total")
+	}
+
+	// A disjoint source contributes nothing, up to estimation noise.
+	other := buildRange(500000, 510000)
+	if got := ContributionOf(total, other); got > 1000 {
+		t.Errorf("disjoint source: expected ~0, got %d", got)
+	}
+	if got := ContributionOf(total, New()); got != 0 {
+		t.Errorf("empty source: expected 0, got %d", got)
+	}
+}
+
+func TestDifferenceOfUnions(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(0, 30000)
+	c := buildRange(20000, 50000)
+	d := buildRange(200000, 300000)
+	regs := append([]uint8(nil), a.registers...)
+
+	cases := []struct {
+		name     string
+		subtract []*LogLogBeta
+		exp      uint64
+	}{
+		{"nothing", nil, a.Cardinality()},
+		{"one", []*LogLogBeta{b}, 70000},
+		{"overlapping", []*LogLogBeta{b, c}, 50000},
+		{"disjoint", []*LogLogBeta{d}, 100000},
+		{"itself", []*LogLogBeta{a}, 0},
+	}
+	for _, tc := range cases {
+		got := DifferenceOfUnions(a, tc.subtract...)
+		if tc.exp == 0 {
+			if got != 0 {
+				t.Errorf("%s: expected 0, got %d", tc.name, got)
+			}
+			continue
+		}
+		if ratio := 100 * estimateError(got, tc.exp); ratio > 5 {
+			t.Errorf("%s: expected ~%d, got %d (%.2f%% error)", tc.name, tc.exp, got, ratio)
+		}
+		if got > a.Cardinality() {
+			t.Errorf("%s: %d exceeds |a| = %d", tc.name, got, a.Cardinality())
+		}
+	}
+
+	if !bytes.Equal(a.registers, regs) {
+		t.Error("DifferenceOfUnions modified a")
+	}
+	if !bytes.Equal(b.registers, buildRange(0, 30000).registers) {
+		t.Error("DifferenceOfUnions modified a subtracted sketch")
+	}
+}
+
+func TestSymmetricDifference(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(60000, 130000)
+	regs := append([]uint8(nil), a.registers...)
+
+	if got := SymmetricDifference(a, b); 100*estimateError(got, 90000) > 5 {
+		t.Errorf("overlapping: expected ~90000, got %d", got)
+	}
+	if got, exp := SymmetricDifference(a, New()), a.Cardinality(); got != exp {
+		t.Errorf("with empty: expected %d, got %d", exp, got)
+	}
+	if got := SymmetricDifference(a, a); got != 0 {
+		t.Errorf("with itself: expected 0, got %d", got)
+	}
+	if SymmetricDifference(a, b) != SymmetricDifference(b, a) {
+		t.Error("SymmetricDifference is not symmetric")
+	}
+	if !bytes.Equal(a.registers, regs) {
+		t.Error("SymmetricDifference modified its input")
+	}
+}
+
+func TestUnionAndOverlap(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(60000, 130000)
+	ra := append([]uint8(nil), a.registers...)
+	rb := append([]uint8(nil), b.registers...)
+
+	u := Union(a, b)
+	if !bytes.Equal(u.registers, buildRange(0, 130000).registers) {
+		t.Error("Union differs from the sketch of the combined range")
+	}
+	if got := a.IntersectionEstimate(b); 100*estimateError(got, 40000) > 10 {
+		t.Errorf("intersection: expected ~40000, got %d", got)
+	}
+	if got := a.JaccardEstimate(b); got < 0.28 || got > 0.34 {
+		t.Errorf("jaccard: expected ~%.3f, got %.3f", 40000.0/130000, got)
+	}
+	if !bytes.Equal(a.registers, ra) || !bytes.Equal(b.registers, rb) {
+		t.Error("inputs were modified")
+	}
+
+	if got := a.JaccardEstimate(a); got != 1 {
+		t.Errorf("with itself: expected 1, got %v", got)
+	}
+	if got := a.JaccardEstimate(buildRange(200000, 300000)); got > 0.02 {
+		t.Errorf("disjoint: expected ~0, got %v", got)
+	}
+	if got := New().JaccardEstimate(New()); got != 0 {
+		t.Errorf("empty: expected 0, got %v", got)
+	}
+}
+
+func TestReachBreakdown(t *testing.T) {
+	channels := map[string]*LogLogBeta{
+		"search": buildRange(0, 100000),
+		"social": buildRange(80000, 150000),
+		"email":  buildRange(140000, 160000),
+		"subset": buildRange(10000, 20000),
+		"none":   nil,
+	}
+	regs := append([]uint8(nil), channels["search"].registers...)
+
+	total, unique := ReachBreakdown(channels)
+	if 100*estimateError(total, 160000) > 3 {
+		t.Errorf("expected total ~160000, got %d", total)
+	}
+	exp := map[string]uint64{"search": 80000, "social": 40000, "email": 10000}
+	for name, want := range exp {
+		if got := unique[name]; 100*estimateError(got, want) > 15 {
+			t.Errorf("%s: expected ~%d, got %d", name, want, got)
+		}
+	}
+	// subset is covered by search, so its unique reach is noise around 0.
+	if got := unique["subset"]; got > 3000 {
+		t.Errorf("subset: expected ~0, got %d", got)
+	}
+	if got, ok := unique["none"]; !ok || got != 0 {
+		t.Errorf("nil channel: expected 0, got %d, %v", got, ok)
+	}
+	if !bytes.Equal(channels["search"].registers, regs) {
+		t.Error("ReachBreakdown modified its input")
+	}
+
+	total, unique = ReachBreakdown(nil)
+	if total != 0 || len(unique) != 0 {
+		t.Errorf("no channels: expected 0 and no entries, got %d, %v", total, unique)
+	}
+}
+
+func TestMultiIntersection(t *testing.T) {
+	a := buildRange(0, 100000)
+	b := buildRange(20000, 120000)
+	c := buildRange(40000, 140000)
+	regs := append([]uint8(nil), a.registers...)
+
+	if got := MultiIntersection(a, b, c); 100*estimateError(got, 60000) > 10 {
+		t.Errorf("three sets: expected ~60000, got %d", got)
+	}
+	if !bytes.Equal(a.registers, regs) {
+		t.Error("MultiIntersection modified its input")
+	}
+	if got, exp := MultiIntersection(a, b), intersection(a, b); got != exp {
+		t.Errorf("two sets: expected %d as from inclusion-exclusion, got %d", exp, got)
+	}
+	if got, exp := MultiIntersection(a), a.Cardinality(); got != exp {
+		t.Errorf("one set: expected %d, got %d", exp, got)
+	}
+	if got := MultiIntersection(a, b, buildRange(200000, 210000)); got > 2000 {
+		t.Errorf("disjoint third set: expected ~0, got %d", got)
+	}
+	if got := MultiIntersection(a, a, a, a); got != a.Cardinality() {
+		t.Errorf("identical sets: expected %d, got %d", a.Cardinality(), got)
+	}
+	if MultiIntersection() != 0 {
+		t.Error("no sets: expected 0")
+	}
+	many := make([]*LogLogBeta, maxIntersectionSets+1)
+	for i := range many {
+		many[i] = a
+	}
+	if MultiIntersection(many...) != 0 {
+		t.Error("too many sets: expected 0")
+	}
+}
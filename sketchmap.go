@@ -0,0 +1,207 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const sketchMapVersion = 1
+
+// SketchMap counts distinct elements per key, such as distinct users per
+// URL, with one sketch for each key. Sketches are created on the first Add
+// to their key and start WithSparseRegisters, so a key with a few hundred
+// elements takes a few kilobytes and only busy keys grow to the full array;
+// millions of mostly small keys stay affordable.
+//
+// Create one with NewSketchMap; a zero SketchMap is only ready for
+// UnmarshalBinary. Like a single LogLogBeta, a SketchMap is not safe for
+// concurrent use.
+type SketchMap struct {
+	tmpl     *LogLogBeta
+	sketches map[string]*LogLogBeta
+}
+
+// KeyCardinality is a key and its estimated number of distinct elements, as
+// listed by SketchMap.TopK.
+type KeyCardinality struct {
+	Key         string
+	Cardinality uint64
+}
+
+type savedSketchMap struct {
+	Version   int
+	Precision uint8
+	HashID    string
+	Keys      []string
+	// Sketches holds the sketch of each key in the smaller of its compact
+	// encodings, which is a few bytes for a sparse sketch.
+	Sketches [][]byte
+}
+
+// NewSketchMap returns an empty SketchMap whose sketches are created with
+// WithSparseRegisters followed by opts.
+func NewSketchMap(opts ...Option) *SketchMap {
+	return &SketchMap{
+		tmpl:     New(append([]Option{WithSparseRegisters()}, opts...)...),
+		sketches: make(map[string]*LogLogBeta),
+	}
+}
+
+// sketch returns the sketch of key, creating it if needed.
+func (sm *SketchMap) sketch(key string) *LogLogBeta {
+	llb, ok := sm.sketches[key]
+	if !ok {
+		llb = sm.tmpl.Clone()
+		sm.sketches[key] = llb
+	}
+	return llb
+}
+
+// Add adds value to the sketch of key.
+func (sm *SketchMap) Add(key string, value []byte) {
+	sm.sketch(key).Add(value)
+}
+
+// AddHash adds the pre-computed hash x to the sketch of key.
+func (sm *SketchMap) AddHash(key string, x uint64) {
+	sm.sketch(key).AddHash(x)
+}
+
+// Cardinality estimates the number of distinct elements added to key, 0 for
+// a key never added to.
+func (sm *SketchMap) Cardinality(key string) uint64 {
+	if llb, ok := sm.sketches[key]; ok {
+		return llb.Cardinality()
+	}
+	return 0
+}
+
+// Sketch returns the sketch of key, or nil if nothing was added to it. The
+// sketch belongs to the map: changes to it show in the map's counts.
+func (sm *SketchMap) Sketch(key string) *LogLogBeta {
+	return sm.sketches[key]
+}
+
+// Delete removes key and its sketch.
+func (sm *SketchMap) Delete(key string) {
+	delete(sm.sketches, key)
+}
+
+// Len returns the number of keys.
+func (sm *SketchMap) Len() int {
+	return len(sm.sketches)
+}
+
+// Keys returns the keys in sorted order.
+func (sm *SketchMap) Keys() []string {
+	keys := make([]string, 0, len(sm.sketches))
+	for key := range sm.sketches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TopK returns the k keys with the largest estimated cardinalities, largest
+// first, with ties broken by key. A k larger than Len, or negative, returns
+// every key.
+func (sm *SketchMap) TopK(k int) []KeyCardinality {
+	all := make([]KeyCardinality, 0, len(sm.sketches))
+	for key, llb := range sm.sketches {
+		all = append(all, KeyCardinality{Key: key, Cardinality: llb.Cardinality()})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Cardinality != all[j].Cardinality {
+			return all[i].Cardinality > all[j].Cardinality
+		}
+		return all[i].Key < all[j].Key
+	})
+	if k >= 0 && k < len(all) {
+		all = all[:k]
+	}
+	return all
+}
+
+// MergeMap merges every sketch of other into the sketch of the same key in
+// sm, adding the keys sm doesn't have yet. The sketches of other are never
+// modified. It returns an error and leaves sm unchanged unless both maps
+// build their sketches with the same precision and hash, as Merge does.
+func (sm *SketchMap) MergeMap(other *SketchMap) error {
+	if err := sm.tmpl.checkMergeable(other.tmpl); err != nil {
+		return err
+	}
+	for key, llb := range other.sketches {
+		if acc, ok := sm.sketches[key]; ok {
+			acc.mustMerge(llb)
+		} else {
+			sm.sketches[key] = llb.Clone()
+		}
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface, writing
+// the whole map as one blob. The precision and hash are stored once and
+// each sketch in the smaller of its compact encodings, so small keys take a
+// few bytes each. As with the compact encoding, alpha and metadata are not
+// stored.
+func (sm *SketchMap) MarshalBinary() ([]byte, error) {
+	s := savedSketchMap{
+		Version:   sketchMapVersion,
+		Precision: sm.tmpl.p,
+		HashID:    sm.tmpl.hashID,
+		Keys:      sm.Keys(),
+	}
+	s.Sketches = make([][]byte, len(s.Keys))
+	for i, key := range s.Keys {
+		s.Sketches[i] = sm.sketches[key].smallestCompact()
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface,
+// replacing the contents of sm with the blob's. A SketchMap only accepts
+// blobs of its own precision and hash and returns an error otherwise,
+// while a zero SketchMap takes them on from the blob.
+func (sm *SketchMap) UnmarshalBinary(data []byte) error {
+	var s savedSketchMap
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != sketchMapVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(s.Version), Want: sketchMapVersion}
+	}
+	if len(s.Keys) != len(s.Sketches) {
+		return errors.New("loglogbeta: invalid sketch map blob")
+	}
+
+	tmpl := sm.tmpl
+	if tmpl == nil {
+		var err error
+		if tmpl, err = NewWithPrecision(s.Precision, WithSparseRegisters()); err != nil {
+			return err
+		}
+		tmpl.hash = nil
+	} else if s.Precision != tmpl.p {
+		return &IncompatibleError{Err: ErrPrecisionMismatch, Got: uint64(s.Precision), Want: uint64(tmpl.p)}
+	}
+	if err := tmpl.adoptHash(s.HashID); err != nil {
+		return err
+	}
+
+	sketches := make(map[string]*LogLogBeta, len(s.Keys))
+	for i, key := range s.Keys {
+		llb := tmpl.Clone()
+		if err := llb.UnmarshalCompact(s.Sketches[i]); err != nil {
+			return fmt.Errorf("loglogbeta: key %q: %w", key, err)
+		}
+		sketches[key] = llb
+	}
+	sm.tmpl, sm.sketches = tmpl, sketches
+	return nil
+}
@@ -0,0 +1,154 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func buildSketchMap(opts ...Option) *SketchMap {
+	sm := NewSketchMap(opts...)
+	// Key k gets 10^k distinct values.
+	n := 1
+	for k := 0; k < 6; k++ {
+		for i := 0; i < n; i++ {
+			sm.Add("key"+strconv.Itoa(k), []byte(strconv.Itoa(i)))
+		}
+		n *= 10
+	}
+	return sm
+}
+
+func TestSketchMap(t *testing.T) {
+	sm := buildSketchMap()
+	if sm.Len() != 6 {
+		t.Fatalf("expected 6 keys, got %d", sm.Len())
+	}
+	n := uint64(1)
+	for k := 0; k < 6; k++ {
+		if got := sm.Cardinality("key" + strconv.Itoa(k)); estimateError(got, n) > 0.02 {
+			t.Errorf("key%d: expected about %d, got %d", k, n, got)
+		}
+		n *= 10
+	}
+	if sm.Cardinality("missing") != 0 || sm.Sketch("missing") != nil {
+		t.Error("missing key isn't empty")
+	}
+	if !sm.Sketch("key2").sparse || sm.Sketch("key5").sparse {
+		t.Error("expected small keys sparse and large ones dense")
+	}
+
+	top := sm.TopK(3)
+	if len(top) != 3 || top[0].Key != "key5" || top[1].Key != "key4" || top[2].Key != "key3" {
+		t.Errorf("unexpected top 3 %v", top)
+	}
+	if top[0].Cardinality != sm.Cardinality("key5") {
+		t.Errorf("top cardinality %d differs from Cardinality", top[0].Cardinality)
+	}
+	if all := sm.TopK(-1); len(all) != 6 || all[5].Key != "key0" {
+		t.Errorf("unexpected full listing %v", all)
+	}
+	sm.AddHash("tie", 1)
+	if all := sm.TopK(100); all[5].Key != "key0" || all[6].Key != "tie" {
+		t.Errorf("ties not broken by key: %v", all)
+	}
+
+	sm.Delete("tie")
+	if keys := sm.Keys(); len(keys) != 6 || keys[0] != "key0" || keys[5] != "key5" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestSketchMapMerge(t *testing.T) {
+	a, b := NewSketchMap(), NewSketchMap()
+	for i := 0; i < 2000; i++ {
+		v := []byte(strconv.Itoa(i))
+		if i < 1500 {
+			a.Add("shared", v)
+		}
+		if i >= 500 {
+			b.Add("shared", v)
+		}
+		b.Add("only-b", v)
+	}
+	exp := b.Sketch("only-b").Cardinality()
+	if err := a.MergeMap(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Cardinality("shared"); estimateError(got, 2000) > 0.02 {
+		t.Errorf("shared: expected about 2000, got %d", got)
+	}
+	if a.Cardinality("only-b") != exp {
+		t.Errorf("only-b: expected %d, got %d", exp, a.Cardinality("only-b"))
+	}
+	a.Add("only-b", []byte("new"))
+	if b.Cardinality("only-b") != exp {
+		t.Error("MergeMap shares sketches with other")
+	}
+	if b.Cardinality("shared") != b.Sketch("shared").Cardinality() || estimateError(b.Cardinality("shared"), 1500) > 0.02 {
+		t.Error("MergeMap modified other")
+	}
+
+	if err := a.MergeMap(NewSketchMap(WithHasherXXHash())); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	if err := a.MergeMap(NewSketchMap(WithPrecision(10))); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+}
+
+func TestSketchMapRoundTrip(t *testing.T) {
+	sm := buildSketchMap(WithHasherXXHash())
+	data, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four small keys and two large ones: little more than two full arrays.
+	if len(data) > 5*int(m)/2 {
+		t.Errorf("blob of %d bytes for mostly small keys", len(data))
+	}
+
+	for name, got := range map[string]*SketchMap{
+		"zero":       {},
+		"configured": NewSketchMap(WithHasherXXHash()),
+	} {
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.Len() != sm.Len() {
+			t.Fatalf("%s: expected %d keys, got %d", name, sm.Len(), got.Len())
+		}
+		for _, key := range sm.Keys() {
+			if !bytes.Equal(got.Sketch(key).dense(), sm.Sketch(key).dense()) {
+				t.Errorf("%s: %s differs", name, key)
+			}
+			checkHist(t, name+" "+key, got.Sketch(key))
+		}
+		if !got.Sketch("key1").sparse {
+			t.Errorf("%s: small key decoded dense", name)
+		}
+		got.Add("key0", []byte("another"))
+		if err := got.MergeMap(sm); err != nil {
+			t.Errorf("%s: decoded map doesn't merge with the original: %v", name, err)
+		}
+	}
+
+	if err := NewSketchMap().UnmarshalBinary(data); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	small, err := buildSketchMap(WithPrecision(10)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SketchMap
+	if err := got.UnmarshalBinary(small); err != nil || got.Sketch("key0").Precision() != 10 {
+		t.Errorf("precision 10: %v", err)
+	}
+	if err := NewSketchMap().UnmarshalBinary(small); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+	if err := new(SketchMap).UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Error("expected an error for garbage")
+	}
+}
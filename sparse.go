@@ -0,0 +1,107 @@
+package loglogbeta
+
+// sparseFraction sets when a sparse sketch becomes dense: once it holds more
+// than one entry per sparseFraction registers, where its four-byte entries
+// take half the memory of one byte per register.
+const sparseFraction = 8
+
+// WithSparseRegisters starts the sketch in a sparse representation, a
+// sorted list of its non-zero registers, instead of the full register
+// array. A sketch of a few hundred elements then takes a few kilobytes
+// rather than 16KB at the default precision. Once more than one register in
+// eight is set, the next write converts the sketch to one byte per register;
+// it is never made sparse again.
+//
+// Add, Merge, Cardinality and the encodings behave exactly as for a regular
+// sketch, and a blob decoded into a sparse sketch keeps it sparse if the
+// registers fit. Writes to a sparse sketch cost a binary search and may
+// allocate as the list grows, unlike those to a dense one. It replaces
+// WithPackedRegisters if both are given.
+func WithSparseRegisters() Option {
+	return func(llb *LogLogBeta) {
+		llb.registers, llb.packed = nil, nil
+		llb.sparse, llb.entries = true, nil
+		llb.hist = histogram{}
+		llb.hist[0] = uint32(1) << llb.p
+	}
+}
+
+// sparseFind returns the position of register k in entries, or where it
+// would be inserted, and whether it is there.
+func (llb *LogLogBeta) sparseFind(k uint64) (int, bool) {
+	lo, hi := 0, len(llb.entries)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if uint64(llb.entries[mid]>>8) < k {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(llb.entries) && uint64(llb.entries[lo]>>8) == k
+}
+
+// setSparse raises register k of a sparse sketch to val. It reports false,
+// changing nothing, if that would take a new entry and the sketch has no
+// room for it.
+func (llb *LogLogBeta) setSparse(k uint64, val uint8) bool {
+	e := uint32(k)<<8 | uint32(val)
+	i, ok := llb.sparseFind(k)
+	if ok {
+		llb.hist[uint8(llb.entries[i])]--
+		llb.entries[i] = e
+	} else {
+		if len(llb.entries) >= llb.numRegisters()/sparseFraction {
+			return false
+		}
+		llb.hist[0]--
+		llb.entries = append(llb.entries, 0)
+		copy(llb.entries[i+1:], llb.entries[i:])
+		llb.entries[i] = e
+	}
+	llb.hist[val]++
+	return true
+}
+
+// densify switches a sparse sketch to one byte per register.
+func (llb *LogLogBeta) densify() {
+	llb.registers = llb.dense()
+	llb.sparse, llb.entries = false, nil
+}
+
+// loadSparse replaces the entries of a sparse sketch with the non-zero
+// registers in regs. It reports false, changing nothing, if there are too
+// many of them.
+func (llb *LogLogBeta) loadSparse(regs []uint8) bool {
+	count := 0
+	for _, v := range regs {
+		if v != 0 {
+			count++
+		}
+	}
+	if count > len(regs)/sparseFraction {
+		return false
+	}
+	entries := llb.entries[:0]
+	if cap(entries) < count {
+		entries = make([]uint32, 0, count)
+	}
+	for i, v := range regs {
+		if v != 0 {
+			entries = append(entries, uint32(i)<<8|uint32(v))
+		}
+	}
+	llb.entries = entries
+	return true
+}
+
+// SparseSizeEstimate returns the number of bytes the registers would take
+// in the layout of WithSparseRegisters, four per non-zero register, which is
+// what RegisterBytes reports for a sparse sketch. Compare it with the 2^p
+// bytes of the dense layout to decide whether a sparse sketch is
+// worthwhile; for a sketch with only a few thousand elements it is
+// typically a small fraction of the dense size. A sparse sketch is made
+// dense once this exceeds half the dense size.
+func (llb *LogLogBeta) SparseSizeEstimate() int {
+	return 4 * (llb.numRegisters() - int(llb.hist[0]))
+}
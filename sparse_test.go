@@ -0,0 +1,132 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestSparseSizeEstimate(t *testing.T) {
+	if got := New().SparseSizeEstimate(); got != 0 {
+		t.Errorf("empty sketch: expected 0, got %d", got)
+	}
+
+	// The estimate is what a sparse sketch of the same registers takes.
+	llb, sparse := New(), New(WithSparseRegisters())
+	for i := 0; i < 1000; i++ {
+		llb.Add([]byte(strconv.Itoa(i)))
+		sparse.Add([]byte(strconv.Itoa(i)))
+	}
+	if !sparse.sparse {
+		t.Fatal("expected the sketch to stay sparse")
+	}
+	if got, exp := llb.SparseSizeEstimate(), sparse.RegisterBytes(); got != exp {
+		t.Errorf("expected the sparse sketch's %d bytes, got %d", exp, got)
+	}
+	if got := llb.SparseSizeEstimate(); got >= New().RegisterBytes()/4 {
+		t.Errorf("small sketch: sparse size %d is not much smaller than dense", got)
+	}
+	full := buildRange(0, 200000)
+	if got := full.SparseSizeEstimate(); got <= full.RegisterBytes() {
+		t.Errorf("full sketch: sparse size %d should exceed dense size %d", got, full.RegisterBytes())
+	}
+}
+
+func TestSparseRegisters(t *testing.T) {
+	llb := New(WithSparseRegisters())
+	exp := New()
+	limit := int(m) / sparseFraction
+	for i := 0; llb.sparse; i++ {
+		v := []byte(strconv.Itoa(i))
+		llb.Add(v)
+		exp.Add(v)
+		if llb.sparse && len(llb.entries) > limit {
+			t.Fatalf("%d entries exceed the limit of %d", len(llb.entries), limit)
+		}
+		if i%500 == 0 {
+			checkHist(t, "sparse", llb)
+			if llb.Cardinality() != exp.Cardinality() {
+				t.Fatalf("after %d adds: expected %d, got %d", i+1, exp.Cardinality(), llb.Cardinality())
+			}
+			if llb.sparse && llb.RegisterBytes() > int(m)/2 {
+				t.Fatalf("sparse sketch takes %d bytes", llb.RegisterBytes())
+			}
+		}
+	}
+	if !bytes.Equal(llb.registers, exp.registers) {
+		t.Error("registers differ after becoming dense")
+	}
+	checkHist(t, "densified", llb)
+}
+
+func TestSparseMergeAndEncode(t *testing.T) {
+	small := New(WithSparseRegisters())
+	for i := 0; i < 300; i++ {
+		small.Add([]byte(strconv.Itoa(i)))
+	}
+	ref := buildRange(0, 300)
+	if !bytes.Equal(small.dense(), ref.registers) {
+		t.Fatal("sparse registers differ from a dense sketch")
+	}
+
+	// Both directions of a merge between the representations.
+	u := New(WithSparseRegisters())
+	u.Merge(small)
+	u.Merge(buildRange(200, 400))
+	if !u.sparse || !bytes.Equal(u.dense(), buildRange(0, 400).registers) {
+		t.Error("merging into a sparse sketch")
+	}
+	d := buildRange(200, 400)
+	d.Merge(small)
+	if !bytes.Equal(d.registers, u.dense()) {
+		t.Error("merging a sparse sketch into a dense one")
+	}
+	big := New(WithSparseRegisters())
+	big.Merge(buildRange(0, 50000))
+	if big.sparse || !bytes.Equal(big.registers, buildRange(0, 50000).registers) {
+		t.Error("merging a large sketch should make the sketch dense")
+	}
+
+	// The encodings don't depend on the representation.
+	a, err := small.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ref.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("sparse and dense sketches encode differently")
+	}
+	got := New(WithSparseRegisters())
+	if err := got.UnmarshalBinary(a); err != nil {
+		t.Fatal(err)
+	}
+	if !got.sparse || !bytes.Equal(got.dense(), ref.registers) {
+		t.Error("decoding a small blob should keep the sketch sparse")
+	}
+	checkHist(t, "decoded", got)
+	if err := got.UnmarshalCompact(mustCompact(t, buildRange(0, 50000))); err != nil || got.sparse {
+		t.Errorf("decoding a large blob should make the sketch dense: %v", err)
+	}
+
+	// A lazy clone doesn't see later writes to the original.
+	fork := small.LazyClone()
+	small.Add([]byte("late"))
+	if !bytes.Equal(fork.dense(), ref.registers) {
+		t.Error("lazy clone saw a later write")
+	}
+	small.Reset()
+	if small.Cardinality() != 0 || !bytes.Equal(fork.dense(), ref.registers) {
+		t.Error("reset")
+	}
+}
+
+func mustCompact(t *testing.T, llb *LogLogBeta) []byte {
+	data, err := llb.MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,251 @@
+package loglogbeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxFrameSize bounds the length prefix accepted by FoldStream so that a
+// corrupt stream can't trigger an arbitrarily large allocation.
+const maxFrameSize = 1 << 24
+
+// FoldStream reads a stream of length-prefixed sketches from r and returns
+// their union. Each frame is a 4-byte big-endian length followed by that many
+// bytes as produced by MarshalBinary. Frames are decoded and merged one at a
+// time, so memory use does not grow with the length of the stream.
+//
+// An empty stream yields an empty sketch. A frame that can't be decoded, for
+// example one written with a different precision, aborts the fold with an
+// error identifying the frame.
+func FoldStream(r io.Reader) (*LogLogBeta, error) {
+	var f folder
+	var hdr [4]byte
+	var buf []byte
+
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return f.result(), nil
+			}
+			return nil, fmt.Errorf("loglogbeta: frame %d: reading length: %w", i, err)
+		}
+
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > maxFrameSize {
+			return nil, fmt.Errorf("loglogbeta: frame %d: length %d exceeds limit %d", i, n, maxFrameSize)
+		}
+		if cap(buf) < int(n) {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("loglogbeta: frame %d: reading body: %w", i, err)
+		}
+
+		if err := f.add(buf); err != nil {
+			return nil, fmt.Errorf("loglogbeta: frame %d: %w", i, err)
+		}
+	}
+}
+
+// FoldFunc returns the union of the sketches yielded by next, which is
+// called repeatedly until it returns false, for example to walk a database
+// cursor. Each call returns a blob produced by MarshalBinary, whether it is
+// valid, and an error. Blobs are decoded and merged one at a time, so memory
+// use does not grow with the number of sketches.
+//
+// An error from next aborts the fold and is returned wrapped, so errors.Is
+// and errors.As see it. A blob that can't be decoded, for example one
+// written with a different precision, aborts the fold with an error
+// identifying the blob by its position.
+func FoldFunc(next func() ([]byte, bool, error)) (*LogLogBeta, error) {
+	var f folder
+	for i := 0; ; i++ {
+		data, ok, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("loglogbeta: blob %d: %w", i, err)
+		}
+		if !ok {
+			return f.result(), nil
+		}
+		if err := f.add(data); err != nil {
+			return nil, fmt.Errorf("loglogbeta: blob %d: %w", i, err)
+		}
+	}
+}
+
+// UnionBlobs decodes blobs produced by MarshalBinary and returns their union,
+// spreading the work over up to workers goroutines (GOMAXPROCS if workers is
+// not positive). Each goroutine folds a contiguous share of the blobs into
+// its own accumulator and the partial unions are merged at the end. Past the
+// first blob of a share, each blob's registers are max-merged straight into
+// the accumulator without building a sketch for it. If any blob fails to
+// decode, the error for the lowest such index is returned. The blobs must
+// share a precision and hash.
+func UnionBlobs(blobs [][]byte, workers int) (*LogLogBeta, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(blobs) {
+		workers = len(blobs)
+	}
+	if workers <= 1 {
+		return unionBlobs(blobs, 0)
+	}
+
+	chunk := (len(blobs) + workers - 1) / workers
+	workers = (len(blobs) + chunk - 1) / chunk
+	parts := make([]*LogLogBeta, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := w*chunk, (w+1)*chunk
+		if hi > len(blobs) {
+			hi = len(blobs)
+		}
+		wg.Add(1)
+		go func(w, lo, hi int) {
+			defer wg.Done()
+			parts[w], errs[w] = unionBlobs(blobs[lo:hi], lo)
+		}(w, lo, hi)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	acc := parts[0]
+	for w, p := range parts[1:] {
+		if err := acc.Merge(p); err != nil {
+			return nil, fmt.Errorf("loglogbeta: blob %d: %w", (w+1)*chunk, err)
+		}
+	}
+	return acc, nil
+}
+
+// unionBlobs folds blobs serially. offset is the index of blobs[0] in the
+// caller's slice and is only used to report errors.
+func unionBlobs(blobs [][]byte, offset int) (*LogLogBeta, error) {
+	var f folder
+	for i, data := range blobs {
+		if err := f.add(data); err != nil {
+			return nil, fmt.Errorf("loglogbeta: blob %d: %w", offset+i, err)
+		}
+	}
+	return f.result(), nil
+}
+
+// folder accumulates the union of decoded blobs. The first blob sets the
+// precision and hash and later ones must match them.
+type folder struct {
+	acc *LogLogBeta
+}
+
+func (f *folder) add(data []byte) error {
+	if f.acc == nil {
+		acc := &LogLogBeta{}
+		if err := acc.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		f.acc = acc
+		return nil
+	}
+	return f.acc.mergeBinary(data)
+}
+
+// mergeBinary merges a blob read by UnmarshalBinary into llb as Merge would
+// merge the decoded sketch, but max-merges the blob's registers straight
+// into llb's instead of building a sketch for them. The blob must have llb's
+// precision and hash; llb is unchanged if it doesn't or is corrupt.
+func (llb *LogLogBeta) mergeBinary(data []byte) error {
+	var d decoded
+	var err error
+	if isCompact(data) {
+		d, err = llb.decodeCompact(data)
+	} else if d, err = decodeGob(data); err == nil {
+		err = llb.acceptPrecision(d.p)
+	}
+	if err != nil {
+		return err
+	}
+	if d.hasHash {
+		if err := llb.checkHash(d.hashID); err != nil {
+			return err
+		}
+	}
+	if err := checkRegisters(d.p, d.regs); err != nil {
+		return err
+	}
+	for i, v := range d.regs {
+		if k := uint64(i); llb.reg(k) < v {
+			llb.setRegister(k, v)
+		}
+	}
+
+	// As mergeMetadata does for a decoded sketch.
+	llb.adds += d.adds
+	if d.created != 0 || d.adds != 0 {
+		created := time.Unix(0, d.created)
+		if !llb.meta || created.Before(llb.created) {
+			llb.created = created
+		}
+	}
+	return nil
+}
+
+// result returns the union, or an empty sketch of the default precision if
+// no blob was added.
+func (f *folder) result() *LogLogBeta {
+	if f.acc == nil {
+		return New()
+	}
+	return f.acc
+}
+
+// AddHashesFrom reads pre-computed hashes from r, each a little-endian
+// uint64, and adds them to the sketch until r is exhausted. It returns the
+// number of hashes added. A trailing partial hash is reported as
+// io.ErrUnexpectedEOF.
+//
+// If progress is non-nil and every is positive, progress is called with the
+// running total after every that many hashes, for example to drive a progress
+// bar on long ingestion runs. With a nil callback there is no per-hash cost.
+func (llb *LogLogBeta) AddHashesFrom(r io.Reader, every uint64, progress func(n uint64)) (uint64, error) {
+	if every == 0 {
+		progress = nil
+	}
+
+	buf := make([]byte, 32*1024)
+	var n uint64
+	have := 0
+	for {
+		k, err := r.Read(buf[have:])
+		have += k
+
+		whole := have - have%8
+		for i := 0; i < whole; i += 8 {
+			llb.AddHash(binary.LittleEndian.Uint64(buf[i:]))
+			n++
+			if progress != nil && n%every == 0 {
+				progress(n)
+			}
+		}
+		have = copy(buf, buf[whole:have])
+
+		if err == io.EOF {
+			if have != 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeFrame(t *testing.T, buf *bytes.Buffer, llb *LogLogBeta) {
+	data, err := llb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(data)))
+	buf.Write(hdr[:])
+	buf.Write(data)
+}
+
+func TestFoldStream(t *testing.T) {
+	var buf bytes.Buffer
+	exp := New()
+
+	for i := 0; i < 5; i++ {
+		llb := New()
+		for j := 0; j < 10000; j++ {
+			str := RandStringBytesMaskImprSrc(rand.Uint32() % 32)
+			llb.Add([]byte(str))
+			exp.Add([]byte(str))
+		}
+		writeFrame(t, &buf, llb)
+	}
+
+	got, err := FoldStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.registers, exp.registers) {
+		t.Error("folded registers differ from the union")
+	}
+}
+
+func TestFoldStreamEmpty(t *testing.T) {
+	got, err := FoldStream(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cardinality() != 0 {
+		t.Errorf("expected empty sketch, got cardinality %d", got.Cardinality())
+	}
+}
+
+func TestFoldStreamErrors(t *testing.T) {
+	var buf bytes.Buffer
+	writeFrame(t, &buf, New())
+	good := buf.Bytes()
+
+	cases := map[string][]byte{
+		"truncated header": good[:2],
+		"truncated body":   good[:len(good)-1],
+		"garbage body":     {0, 0, 0, 3, 1, 2, 3},
+		"oversized frame":  {0xff, 0xff, 0xff, 0xff},
+	}
+	for name, data := range cases {
+		if _, err := FoldStream(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestUnionBlobs(t *testing.T) {
+	exp := New()
+	var blobs [][]byte
+	for i := 0; i < 37; i++ {
+		llb := buildRange(i*1000, i*1000+5000)
+		exp.Merge(llb)
+		data, err := llb.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, data)
+	}
+
+	for _, workers := range []int{-1, 0, 1, 2, 5, 10, 36, 37, 100} {
+		got, err := UnionBlobs(blobs, workers)
+		if err != nil {
+			t.Fatalf("workers=%d: %v", workers, err)
+		}
+		if !bytes.Equal(got.registers, exp.registers) {
+			t.Errorf("workers=%d: registers differ from the union", workers)
+		}
+	}
+
+	got, err := UnionBlobs(nil, 4)
+	if err != nil || got.Cardinality() != 0 {
+		t.Errorf("no blobs: expected empty sketch, got %v, %v", got, err)
+	}
+
+	bad := append([][]byte(nil), blobs...)
+	bad[20] = []byte("garbage")
+	bad[30] = []byte("garbage")
+	if _, err := UnionBlobs(bad, 4); err == nil || !strings.Contains(err.Error(), "blob 20") {
+		t.Errorf("expected error for blob 20, got %v", err)
+	}
+}
+
+func TestMergeBinary(t *testing.T) {
+	acc := buildRange(0, 1000)
+	exp := acc.Clone()
+	src := New(WithMetadata())
+	for i := 500; i < 3000; i++ {
+		src.Add([]byte(strconv.Itoa(i)))
+	}
+	exp.Merge(src)
+
+	gobBlob, _ := src.MarshalBinary()
+	compact, _ := src.MarshalCompact()
+	rle, _ := src.MarshalCompactRLE()
+	for name, data := range map[string][]byte{"gob": gobBlob, "compact": compact, "rle": rle} {
+		got := acc.Clone()
+		if err := got.mergeBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got.registers, exp.registers) {
+			t.Errorf("%s: registers differ from Merge", name)
+		}
+		checkHist(t, name, got)
+	}
+	// Metadata is merged as Merge does.
+	withMeta := New(WithMetadata())
+	got := withMeta.Clone()
+	got.mergeBinary(gobBlob)
+	want := withMeta.Plus(src)
+	if c, adds := got.Metadata(); adds != 2500 || !c.Equal(want.created) {
+		t.Errorf("metadata: got %v and %d adds, want %v and 2500", c, adds, want.created)
+	}
+
+	// The accumulator is updated in place: a compact blob merges without
+	// allocating.
+	if n := testing.AllocsPerRun(10, func() { got.mergeBinary(compact) }); n != 0 {
+		t.Errorf("expected no allocations, got %v", n)
+	}
+
+	xx, _ := New(WithHasherXXHash()).MarshalCompact()
+	small, _ := NewWithPrecision(10)
+	p10, _ := small.MarshalBinary()
+	before := append([]uint8(nil), got.registers...)
+	for name, data := range map[string][]byte{"hash": xx, "precision": p10, "garbage": []byte("garbage")} {
+		if err := got.mergeBinary(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if !bytes.Equal(got.registers, before) {
+		t.Error("a refused blob changed the registers")
+	}
+}
+
+func TestFoldFunc(t *testing.T) {
+	exp := New()
+	var blobs [][]byte
+	for i := 0; i < 5; i++ {
+		llb := buildRange(i*1000, i*1000+3000)
+		exp.Merge(llb)
+		data, err := llb.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, data)
+	}
+	cursor := func(blobs [][]byte) func() ([]byte, bool, error) {
+		return func() ([]byte, bool, error) {
+			if len(blobs) == 0 {
+				return nil, false, nil
+			}
+			data := blobs[0]
+			blobs = blobs[1:]
+			return data, true, nil
+		}
+	}
+
+	got, err := FoldFunc(cursor(blobs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.registers, exp.registers) {
+		t.Error("folded registers differ from the union")
+	}
+
+	got, err = FoldFunc(cursor(nil))
+	if err != nil || got.Cardinality() != 0 {
+		t.Errorf("no blobs: expected empty sketch, got %v, %v", got, err)
+	}
+
+	bad := append([][]byte(nil), blobs...)
+	bad[3] = []byte("garbage")
+	if _, err := FoldFunc(cursor(bad)); err == nil || !strings.Contains(err.Error(), "blob 3") {
+		t.Errorf("expected error for blob 3, got %v", err)
+	}
+
+	failing := errors.New("connection reset")
+	n := 0
+	_, err = FoldFunc(func() ([]byte, bool, error) {
+		if n++; n > 2 {
+			return nil, false, failing
+		}
+		return blobs[0], true, nil
+	})
+	if !errors.Is(err, failing) {
+		t.Errorf("expected the cursor error, got %v", err)
+	}
+}
+
+func TestAddHashesFrom(t *testing.T) {
+	const total = 100003
+	var buf bytes.Buffer
+	exp := New()
+	var b [8]byte
+	for i := 0; i < total; i++ {
+		x := rand.Uint64()
+		exp.AddHash(x)
+		binary.LittleEndian.PutUint64(b[:], x)
+		buf.Write(b[:])
+	}
+	data := buf.Bytes()
+
+	llb := New()
+	var calls []uint64
+	n, err := llb.AddHashesFrom(bytes.NewReader(data), 10000, func(n uint64) {
+		calls = append(calls, n)
+	})
+	if err != nil || n != total {
+		t.Fatalf("expected %d hashes and no error, got %d, %v", total, n, err)
+	}
+	if !bytes.Equal(llb.registers, exp.registers) {
+		t.Error("registers differ from adding the hashes directly")
+	}
+	if len(calls) != 10 || calls[0] != 10000 || calls[9] != 100000 {
+		t.Errorf("unexpected progress calls %v", calls)
+	}
+
+	// A reader that returns a few bytes at a time must give the same result.
+	llb = New()
+	n, err = llb.AddHashesFrom(&slowReader{data: data}, 0, nil)
+	if err != nil || n != total || !bytes.Equal(llb.registers, exp.registers) {
+		t.Errorf("slow reader: got %d, %v", n, err)
+	}
+
+	n, err = New().AddHashesFrom(bytes.NewReader(data[:8*3+5]), 1, nil)
+	if n != 3 || err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated input: expected 3, ErrUnexpectedEOF, got %d, %v", n, err)
+	}
+}
+
+type slowReader struct {
+	data []byte
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > 5 {
+		p = p[:5]
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
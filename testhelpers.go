@@ -0,0 +1,44 @@
+package loglogbeta
+
+import (
+	"fmt"
+	"math"
+)
+
+// alphaTable holds the published bias-correction constants by precision,
+// written out so that an accidental edit of alpha is caught by NewForTest.
+var alphaTable = map[uint8]float64{
+	4:  0.673,
+	5:  0.697,
+	6:  0.709,
+	7:  0.7152704932638152,
+	8:  0.7182725932495458,
+	9:  0.7197831133217303,
+	10: 0.7205407583220416,
+	11: 0.7209201792610241,
+	12: 0.7211100396160289,
+	13: 0.7212050072994537,
+	14: 0.7212525005219688,
+	15: 0.7212762494789677,
+	16: 0.7212881245439701,
+	17: 0.7212940622231054,
+	18: 0.7212970310993325,
+}
+
+// NewForTest returns an empty sketch for use in tests: precision p, Add
+// hashing with metro seeded with seed, and a freshly computed alpha. It
+// panics if p isn't between MinPrecision and MaxPrecision, or if the
+// computed alpha doesn't match the published constant for p, so a
+// misconfigured test fails loudly instead of producing subtly different
+// estimates.
+func NewForTest(p uint8, seed uint64) *LogLogBeta {
+	llb, err := NewWithPrecision(p, WithHasherMetroSeed(seed))
+	if err != nil {
+		panic(fmt.Sprintf("loglogbeta: NewForTest: %v", err))
+	}
+	llb.alpha = alpha(float64(uint64(1) << p))
+	if want := alphaTable[p]; math.Abs(llb.alpha-want) > 1e-12 {
+		panic(fmt.Sprintf("loglogbeta: NewForTest: alpha for precision %d is %v, want %v", p, llb.alpha, want))
+	}
+	return llb
+}
@@ -0,0 +1,41 @@
+package loglogbeta
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAlphaTable(t *testing.T) {
+	for p, want := range alphaTable {
+		if got := alpha(float64(uint64(1) << p)); math.Abs(got-want) > 1e-12 {
+			t.Errorf("precision %d: alpha is %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestNewForTest(t *testing.T) {
+	a := NewForTest(precision, 1337)
+	b := New()
+	a.Add([]byte("hello"))
+	b.Add([]byte("hello"))
+	if a.Fingerprint() != b.Fingerprint() || a.alpha != b.alpha {
+		t.Error("seed 1337 should match the default sketch")
+	}
+
+	c := NewForTest(precision, 42)
+	c.Add([]byte("hello"))
+	if c.Fingerprint() == b.Fingerprint() {
+		t.Error("a different seed should hash differently")
+	}
+
+	if got := NewForTest(10, 1).Precision(); got != 10 {
+		t.Errorf("expected precision 10, got %d", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unsupported precision")
+		}
+	}()
+	NewForTest(3, 1)
+}
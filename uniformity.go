@@ -0,0 +1,103 @@
+package loglogbeta
+
+import "math"
+
+// uniformityBits is the number of top hash bits WithIndexUniformity bins
+// by, giving 64 bins of 256 registers each at the default precision.
+const uniformityBits = 6
+
+// WithIndexUniformity makes the sketch count how the hashes it is given
+// spread over the register indexes, so IndexUniformityPValue can flag an
+// upstream hash that favours some registers over others. Hashes are binned
+// by their top bits, which is where AddHash takes the index from. The cost
+// is 64 counters and an increment per AddHash; sketches without the option
+// pay only a nil check. The counts are not serialized and Merge doesn't
+// combine them: they describe the input this sketch was given directly.
+func WithIndexUniformity() Option {
+	return func(llb *LogLogBeta) {
+		llb.bins = make([]uint64, 1<<uniformityBits)
+	}
+}
+
+// IndexUniformityPValue returns the p-value of a chi-square test of the
+// hypothesis that the hashes given to AddHash select registers uniformly. A
+// value below 0.001 or so means the hash is skewing register selection,
+// which biases the estimate. It returns 1, no evidence of skew, for a
+// sketch created without WithIndexUniformity or that has seen fewer than 5
+// hashes per bin, the usual minimum for the test to be meaningful.
+//
+// Every call counts, including repeated elements. A stream dominated by a
+// few heavy hitters fails the test however good the hash is, so feed it
+// distinct values, or a de-duplicated sample, when using it as a quality gate.
+func (llb *LogLogBeta) IndexUniformityPValue() float64 {
+	total := uint64(0)
+	for _, c := range llb.bins {
+		total += c
+	}
+	k := float64(len(llb.bins))
+	if total == 0 || float64(total) < 5*k {
+		return 1
+	}
+
+	exp := float64(total) / k
+	chi2 := 0.0
+	for _, c := range llb.bins {
+		d := float64(c) - exp
+		chi2 += d * d / exp
+	}
+	return gammaQ((k-1)/2, chi2/2)
+}
+
+// gammaQ returns the regularized upper incomplete gamma function Q(a, x),
+// the survival function of the chi-square distribution with 2a degrees of
+// freedom at 2x. It uses the series for P when x < a+1 and Lentz's continued
+// fraction for Q otherwise, as in Numerical Recipes.
+func gammaQ(a, x float64) float64 {
+	const (
+		eps   = 1e-15
+		iters = 1000
+		tiny  = 1e-300
+	)
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lg)
+
+	if x < a+1 {
+		term := 1 / a
+		sum := term
+		for n := 1; n < iters; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*eps {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < iters; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h * prefix
+}
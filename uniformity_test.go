@@ -0,0 +1,67 @@
+package loglogbeta
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGammaQ(t *testing.T) {
+	// Reference values of the chi-square survival function, from the closed
+	// forms for one and an even number of degrees of freedom.
+	cases := []struct {
+		df, x, exp float64
+	}{
+		{1, 0.5, 0.4795001221869535},
+		{1, 3.841459, 0.04999999465319576},
+		{2, 3, 0.22313016014842982},
+		{10, 18.307038, 0.050000000824732264},
+		{64, 63, 0.5118894636642863},
+		{64, 83.675261, 0.049999998036277866},
+		{64, 104.716, 0.0010000701217225167},
+	}
+	for _, c := range cases {
+		if got := gammaQ(c.df/2, c.x/2); math.Abs(got-c.exp) > 1e-9 {
+			t.Errorf("df=%v x=%v: expected %v, got %v", c.df, c.x, c.exp, got)
+		}
+	}
+}
+
+func TestIndexUniformityPValue(t *testing.T) {
+	if p := New().IndexUniformityPValue(); p != 1 {
+		t.Errorf("without tracking: expected 1, got %v", p)
+	}
+	few := New(WithIndexUniformity())
+	few.AddHash(1)
+	if p := few.IndexUniformityPValue(); p != 1 {
+		t.Errorf("too few samples: expected 1, got %v", p)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	good := New(WithIndexUniformity())
+	for i := 0; i < 100000; i++ {
+		good.AddHash(rng.Uint64())
+	}
+	if p := good.IndexUniformityPValue(); p < 0.001 {
+		t.Errorf("uniform hashes flagged with p=%v", p)
+	}
+
+	// A hash that never sets the top bit only ever reaches half the
+	// registers.
+	bad := New(WithIndexUniformity())
+	for i := 0; i < 100000; i++ {
+		bad.AddHash(rng.Uint64() >> 1)
+	}
+	if p := bad.IndexUniformityPValue(); p > 1e-6 {
+		t.Errorf("skewed hashes not flagged, p=%v", p)
+	}
+
+	// A lazy clone keeps its own counts.
+	fork := good.LazyClone()
+	for i := 0; i < 100000; i++ {
+		good.AddHash(rng.Uint64() >> 1)
+	}
+	if p := fork.IndexUniformityPValue(); p < 0.001 {
+		t.Errorf("fork picked up the original's counts, p=%v", p)
+	}
+}
@@ -0,0 +1,32 @@
+package loglogbeta
+
+// updateBranchless raises register k to val if val is larger, like the
+// compare-and-set in AddHash, but computes the new value with a branchless
+// byte max and writes the register and its counts unconditionally. That
+// trades the branch for a few stores to memory that is in cache anyway.
+//
+// It only pays off when the branch is unpredictable, while a sketch is still
+// filling up and about half the inserts raise a register. Once the sketch is
+// saturated almost no insert raises a register, the branch is predicted
+// correctly and the regular path is roughly twice as fast; see
+// BenchmarkAddHashSaturated and BenchmarkAddHashFresh. Build with the
+// loglogbeta_branchless tag to make AddHash use it.
+//
+// Packed and sparse sketches, sketches sharing their registers with a lazy
+// clone and sketches tracking register ages take the regular path.
+func (llb *LogLogBeta) updateBranchless(k uint64, val uint8) {
+	if llb.sparse || llb.packed != nil || llb.shared || llb.ages != nil {
+		if llb.reg(k) < val {
+			llb.setRegister(k, val)
+		}
+		return
+	}
+	old := llb.registers[k]
+	// The difference is negative exactly when val is larger, and shifting
+	// it right fills the mask with its sign.
+	mask := uint8((int(old) - int(val)) >> 8)
+	v := old ^ (old^val)&mask
+	llb.hist[old]--
+	llb.hist[v]++
+	llb.registers[k] = v
+}
@@ -0,0 +1,6 @@
+//go:build !loglogbeta_branchless
+
+package loglogbeta
+
+// branchlessUpdate selects updateBranchless in AddHash; see there.
+const branchlessUpdate = false
@@ -0,0 +1,94 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestUpdateBranchless(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a, b := New(), New()
+	for i := 0; i < 500000; i++ {
+		k, val := getPosVal(rng.Uint64(), precision)
+		if a.registers[k] < val {
+			a.setRegister(k, val)
+		}
+		b.updateBranchless(k, val)
+	}
+	if !bytes.Equal(a.registers, b.registers) || a.hist != b.hist {
+		t.Error("branchless update differs from the compare-and-set")
+	}
+	checkHist(t, "branchless", b)
+
+	// The fallback keeps a lazy clone independent.
+	before := b.registers[0]
+	fork := b.LazyClone()
+	b.updateBranchless(0, maxRank)
+	if fork.registers[0] != before || b.registers[0] != maxRank {
+		t.Error("branchless update wrote through to a lazy clone")
+	}
+}
+
+// saturatedHashes returns a sketch filled with 10 million elements and a set
+// of hashes that, like most further inserts into it, rarely raise a
+// register.
+func saturatedHashes() (*LogLogBeta, []uint64) {
+	rng := rand.New(rand.NewSource(1))
+	llb := New()
+	for i := 0; i < 10000000; i++ {
+		llb.AddHash(rng.Uint64())
+	}
+	hashes := make([]uint64, 1<<16)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+	}
+	return llb, hashes
+}
+
+func BenchmarkAddHashSaturated(b *testing.B) {
+	llb, hashes := saturatedHashes()
+	b.Run("branch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			k, val := getPosVal(hashes[i&(len(hashes)-1)], precision)
+			if llb.registers[k] < val {
+				llb.setRegister(k, val)
+			}
+		}
+	})
+	b.Run("branchless", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			k, val := getPosVal(hashes[i&(len(hashes)-1)], precision)
+			llb.updateBranchless(k, val)
+		}
+	})
+}
+
+func BenchmarkAddHashFresh(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	hashes := make([]uint64, 1<<16)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+	}
+	b.Run("branch", func(b *testing.B) {
+		llb := New()
+		for i := 0; i < b.N; i++ {
+			if i&(len(hashes)-1) == 0 {
+				llb.Reset()
+			}
+			k, val := getPosVal(hashes[i&(len(hashes)-1)], precision)
+			if llb.registers[k] < val {
+				llb.setRegister(k, val)
+			}
+		}
+	})
+	b.Run("branchless", func(b *testing.B) {
+		llb := New()
+		for i := 0; i < b.N; i++ {
+			if i&(len(hashes)-1) == 0 {
+				llb.Reset()
+			}
+			llb.updateBranchless(getPosVal(hashes[i&(len(hashes)-1)], precision))
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// VerifyMergeConsistency is a smoke test of the merge path against real data.
+// It adds inputs to a single sketch, then distributes them at random over
+// partitions sketches, copying some of them into a second partition to
+// create overlap, merges the partitions pairwise in a random tree, and checks
+// that the result matches the single sketch register for register. seed makes
+// the partitioning and merge order reproducible, and every sketch is created
+// with opts. It returns nil on success and an error describing the first
+// discrepancy otherwise.
+func VerifyMergeConsistency(inputs [][]byte, partitions int, seed int64, opts ...Option) error {
+	if partitions < 1 {
+		return errors.New("loglogbeta: partitions must be positive")
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	whole := New(opts...)
+	parts := make([]*LogLogBeta, partitions)
+	for i := range parts {
+		parts[i] = New(opts...)
+	}
+	for _, v := range inputs {
+		whole.Add(v)
+		parts[rng.Intn(partitions)].Add(v)
+		if rng.Intn(4) == 0 {
+			parts[rng.Intn(partitions)].Add(v)
+		}
+	}
+
+	for len(parts) > 1 {
+		i := rng.Intn(len(parts))
+		j := rng.Intn(len(parts) - 1)
+		if j >= i {
+			j++
+		}
+		merged := parts[i].Plus(parts[j])
+		if i < j {
+			i, j = j, i
+		}
+		parts[i] = parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+		parts[j] = merged
+	}
+
+	got := parts[0]
+	if a, b := got.dense(), whole.dense(); !bytes.Equal(a, b) {
+		for k := range a {
+			if a[k] != b[k] {
+				return fmt.Errorf("loglogbeta: register %d is %d after merging, %d in the single sketch",
+					k, a[k], b[k])
+			}
+		}
+	}
+	if a, b := got.Cardinality(), whole.Cardinality(); a != b {
+		return fmt.Errorf("loglogbeta: merged cardinality %d, single sketch %d", a, b)
+	}
+	return nil
+}
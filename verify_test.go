@@ -0,0 +1,34 @@
+package loglogbeta
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestVerifyMergeConsistency(t *testing.T) {
+	var inputs [][]byte
+	for i := 0; i < 50000; i++ {
+		inputs = append(inputs, []byte(strconv.Itoa(i)))
+	}
+	for _, partitions := range []int{1, 2, 7, 64} {
+		for seed := int64(0); seed < 3; seed++ {
+			if err := VerifyMergeConsistency(inputs, partitions, seed); err != nil {
+				t.Errorf("partitions=%d seed=%d: %v", partitions, seed, err)
+			}
+		}
+	}
+	for _, opts := range [][]Option{
+		{WithPrecision(10)},
+		{WithPackedRegisters(), WithHasherXXHash()},
+	} {
+		if err := VerifyMergeConsistency(inputs[:5000], 5, 1, opts...); err != nil {
+			t.Errorf("with options: %v", err)
+		}
+	}
+	if err := VerifyMergeConsistency(nil, 3, 0); err != nil {
+		t.Errorf("no inputs: %v", err)
+	}
+	if err := VerifyMergeConsistency(inputs, 0, 0); err == nil {
+		t.Error("expected an error for zero partitions")
+	}
+}
@@ -0,0 +1,51 @@
+package loglogbeta
+
+// UnionView maintains the union of a growing collection of sketches so its
+// cardinality can be queried repeatedly without re-merging the whole
+// collection. Each added sketch is merged into an internal accumulator once.
+//
+// Sketches can't be removed: max-merging is irreversible, so dropping a
+// member means building a new view from the remaining ones.
+type UnionView struct {
+	acc *LogLogBeta
+	n   int
+	// fixed is set if the view was created with options, which then decide
+	// the precision and hash instead of the first sketch added.
+	fixed bool
+}
+
+// NewUnionView returns an empty UnionView. Without opts it takes on the
+// precision and hash of the first sketch added; with them, its union is
+// created with opts and only accepts sketches of that precision and hash.
+func NewUnionView(opts ...Option) *UnionView {
+	return &UnionView{acc: New(opts...), fixed: len(opts) > 0}
+}
+
+// Add merges s into the view. s is not retained or modified. A sketch whose
+// precision or hash differs from the view's is rejected with Merge's error.
+func (v *UnionView) Add(s *LogLogBeta) error {
+	if v.n == 0 && !v.fixed {
+		v.acc = s.newLike()
+	}
+	if err := v.acc.Merge(s); err != nil {
+		return err
+	}
+	v.n++
+	return nil
+}
+
+// Len returns the number of sketches added to the view.
+func (v *UnionView) Len() int {
+	return v.n
+}
+
+// Cardinality returns the estimated cardinality of the union of all sketches
+// added so far.
+func (v *UnionView) Cardinality() uint64 {
+	return v.acc.Cardinality()
+}
+
+// Union returns a copy of the current union.
+func (v *UnionView) Union() *LogLogBeta {
+	return v.acc.Clone()
+}
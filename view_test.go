@@ -0,0 +1,50 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnionView(t *testing.T) {
+	v := NewUnionView()
+	if v.Cardinality() != 0 || v.Len() != 0 {
+		t.Fatal("expected an empty view")
+	}
+
+	exp := New()
+	for i := 0; i < 10; i++ {
+		s := buildRange(i*5000, i*5000+8000)
+		v.Add(s)
+		exp.Merge(s)
+		if got := v.Cardinality(); got != exp.Cardinality() {
+			t.Errorf("after %d sketches: expected %d, got %d", i+1, exp.Cardinality(), got)
+		}
+	}
+	if v.Len() != 10 {
+		t.Errorf("expected Len 10, got %d", v.Len())
+	}
+
+	u := v.Union()
+	if !bytes.Equal(u.registers, exp.registers) {
+		t.Error("Union registers differ from the merged sketches")
+	}
+	u.Add([]byte("not in the view"))
+	if v.Cardinality() != exp.Cardinality() {
+		t.Error("modifying the returned union changed the view")
+	}
+
+	// A view created with options keeps them rather than taking on the
+	// first sketch's precision.
+	fixed := NewUnionView(WithPrecision(10))
+	if u := fixed.Union(); u.Precision() != 10 {
+		t.Errorf("empty view: expected precision 10, got %d", u.Precision())
+	}
+	if err := fixed.Add(New()); err == nil {
+		t.Error("expected an error for a sketch of another precision")
+	}
+	small, _ := NewWithPrecision(10)
+	small.Add([]byte("x"))
+	if err := fixed.Add(small); err != nil || fixed.Cardinality() != 1 {
+		t.Errorf("expected 1, got %d, %v", fixed.Cardinality(), err)
+	}
+}
@@ -0,0 +1,294 @@
+package loglogbeta
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const windowedVersion = 1
+
+var errWindowMismatch = errors.New("loglogbeta: window mismatch")
+
+// Windowed counts the distinct elements seen over a sliding time window. Time
+// is cut into buckets of the given granularity, each with its own sketch, and
+// only the buckets that fall within the window of the newest one are kept: a
+// bucket's sketch is reset and reused once it has slid out of the window.
+// Queries merge the live buckets, so CardinalitySince can answer for any
+// suffix of the window at bucket resolution.
+//
+// Memory is bounded by the number of buckets, window/granularity rounded up,
+// each holding one sketch. A bucket's sketch is only allocated once something
+// is added to it, and sketches created WithSparseRegisters keep quiet buckets
+// small.
+//
+// Time only moves forward: the newest bucket seen so far defines the window,
+// and elements added at an earlier time than it allows are dropped.
+type Windowed struct {
+	gran int64
+	tmpl *LogLogBeta
+	// buckets[i] is the sketch of bucket starts[i], nil if the slot has never
+	// been used. Bucket b lives in slot b mod len(buckets).
+	buckets []*LogLogBeta
+	starts  []int64
+	// latest is the newest bucket added to, valid once any is set.
+	latest int64
+	any    bool
+}
+
+type savedWindowed struct {
+	Version     int
+	Granularity int64
+	Buckets     int
+	Latest      int64
+	// Starts and Sketches hold the live buckets, the latter in their
+	// MarshalBinary form.
+	Starts   []int64
+	Sketches [][]byte
+}
+
+// NewWindowed returns an empty Windowed covering the given window in buckets
+// of granularity, whose sketches are created with opts. The window is
+// rounded up to a whole number of buckets and covers at least one. It panics
+// if granularity isn't positive.
+func NewWindowed(window, granularity time.Duration, opts ...Option) *Windowed {
+	if granularity <= 0 {
+		panic("loglogbeta: NewWindowed with non-positive granularity")
+	}
+	n := int((window + granularity - 1) / granularity)
+	if n < 1 {
+		n = 1
+	}
+	return &Windowed{
+		gran:    int64(granularity),
+		tmpl:    New(opts...),
+		buckets: make([]*LogLogBeta, n),
+		starts:  make([]int64, n),
+	}
+}
+
+// Window returns the span covered, a whole number of granularities.
+func (w *Windowed) Window() time.Duration {
+	return time.Duration(w.gran * int64(len(w.buckets)))
+}
+
+// Granularity returns the span of each bucket.
+func (w *Windowed) Granularity() time.Duration {
+	return time.Duration(w.gran)
+}
+
+// bucketOf returns the number of the bucket holding t, rounding down for
+// times before the Unix epoch.
+func (w *Windowed) bucketOf(t time.Time) int64 {
+	ns := t.UnixNano()
+	b := ns / w.gran
+	if ns%w.gran < 0 {
+		b--
+	}
+	return b
+}
+
+func (w *Windowed) slot(b int64) int {
+	s := int(b % int64(len(w.buckets)))
+	if s < 0 {
+		s += len(w.buckets)
+	}
+	return s
+}
+
+// expired reports whether bucket b is outside the window.
+func (w *Windowed) expired(b int64) bool {
+	return w.any && b <= w.latest-int64(len(w.buckets))
+}
+
+// live returns the sketch in slot s if it holds a bucket within the window.
+func (w *Windowed) live(s int) *LogLogBeta {
+	if w.buckets[s] == nil || w.expired(w.starts[s]) {
+		return nil
+	}
+	return w.buckets[s]
+}
+
+// advance moves the window forward to end at bucket b if b is newer.
+func (w *Windowed) advance(b int64) {
+	if !w.any || b > w.latest {
+		w.latest, w.any = b, true
+	}
+}
+
+// bucket returns the sketch for bucket b, which must be within the window,
+// taking over its slot if that still holds an expired bucket.
+func (w *Windowed) bucket(b int64) *LogLogBeta {
+	s := w.slot(b)
+	switch {
+	case w.buckets[s] == nil:
+		w.buckets[s] = w.tmpl.Clone()
+	case w.starts[s] != b:
+		w.buckets[s].Reset()
+	}
+	w.starts[s] = b
+	return w.buckets[s]
+}
+
+// AddHashAt adds the pre-computed hash x as seen at t. It is dropped if t is
+// older than the window of the newest bucket added to.
+func (w *Windowed) AddHashAt(x uint64, t time.Time) {
+	b := w.bucketOf(t)
+	if w.expired(b) {
+		return
+	}
+	w.advance(b)
+	w.bucket(b).AddHash(x)
+}
+
+// AddAt adds value as seen at t. It is dropped if t is older than the window
+// of the newest bucket added to.
+func (w *Windowed) AddAt(value []byte, t time.Time) {
+	w.AddHashAt(w.tmpl.hash(value), t)
+}
+
+// Add adds value as seen now.
+func (w *Windowed) Add(value []byte) {
+	w.AddAt(value, time.Now())
+}
+
+// SketchSince returns a new sketch holding the union of the buckets from the
+// one containing t to the newest. Buckets that have slid out of the window
+// are never included, so an early t covers the whole window.
+func (w *Windowed) SketchSince(t time.Time) *LogLogBeta {
+	return w.unionFrom(w.bucketOf(t))
+}
+
+// unionFrom returns the union of the live buckets from bucket from onwards.
+func (w *Windowed) unionFrom(from int64) *LogLogBeta {
+	u := w.tmpl.newLike()
+	for s := range w.buckets {
+		if b := w.live(s); b != nil && w.starts[s] >= from {
+			u.mustMerge(b)
+		}
+	}
+	return u
+}
+
+// CardinalitySince estimates the number of distinct elements added from the
+// bucket containing t onwards; see SketchSince.
+func (w *Windowed) CardinalitySince(t time.Time) uint64 {
+	return w.SketchSince(t).Cardinality()
+}
+
+// Cardinality estimates the number of distinct elements across the window.
+func (w *Windowed) Cardinality() uint64 {
+	return w.unionFrom(math.MinInt64).Cardinality()
+}
+
+// Merge folds other into w bucket by bucket, as if every element added to
+// other had been added to w at the same time. The window ends at the newer of
+// the two, so other's buckets older than that are dropped. It returns an
+// error wrapping errWindowMismatch and leaves w unchanged unless both have
+// the same granularity and number of buckets, and an error from
+// LogLogBeta.Merge if their sketches can't be merged.
+func (w *Windowed) Merge(other *Windowed) error {
+	if w.gran != other.gran || len(w.buckets) != len(other.buckets) {
+		return fmt.Errorf("%w: %v/%v, want %v/%v", errWindowMismatch,
+			other.Window(), other.Granularity(), w.Window(), w.Granularity())
+	}
+	if err := w.tmpl.checkMergeable(other.tmpl); err != nil {
+		return err
+	}
+	if !other.any {
+		return nil
+	}
+	w.advance(other.latest)
+	for s := range other.buckets {
+		ob := other.live(s)
+		if ob == nil || w.expired(other.starts[s]) {
+			continue
+		}
+		b := other.starts[s]
+		if w.buckets[s] != nil && w.starts[s] == b {
+			w.buckets[s].mustMerge(ob)
+			continue
+		}
+		w.buckets[s], w.starts[s] = ob.Clone(), b
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. Only the
+// buckets within the window are written.
+func (w *Windowed) MarshalBinary() ([]byte, error) {
+	s := savedWindowed{
+		Version:     windowedVersion,
+		Granularity: w.gran,
+		Buckets:     len(w.buckets),
+		Latest:      w.latest,
+	}
+	for i := range w.buckets {
+		b := w.live(i)
+		if b == nil {
+			continue
+		}
+		data, err := b.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		s.Starts = append(s.Starts, w.starts[i])
+		s.Sketches = append(s.Sketches, data)
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It
+// replaces w's window and buckets with the blob's. The bucket sketches are
+// decoded like LogLogBeta.UnmarshalBinary into sketches configured as w's, so
+// their precision and hash must match; a zero Windowed takes them on from
+// the blob.
+func (w *Windowed) UnmarshalBinary(data []byte) error {
+	var s savedWindowed
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != windowedVersion {
+		return &IncompatibleError{Err: ErrVersionUnsupported, Got: uint64(s.Version), Want: windowedVersion}
+	}
+	if s.Granularity <= 0 || s.Buckets < 1 || len(s.Starts) != len(s.Sketches) || len(s.Starts) > s.Buckets {
+		return errors.New("loglogbeta: invalid windowed blob")
+	}
+
+	tmpl := w.tmpl
+	r := &Windowed{
+		gran:    s.Granularity,
+		buckets: make([]*LogLogBeta, s.Buckets),
+		starts:  make([]int64, s.Buckets),
+		latest:  s.Latest,
+		any:     len(s.Starts) > 0,
+	}
+	for i, blob := range s.Sketches {
+		b := &LogLogBeta{}
+		if tmpl != nil {
+			b = tmpl.Clone()
+		}
+		if err := b.UnmarshalBinary(blob); err != nil {
+			return fmt.Errorf("loglogbeta: bucket %d: %w", s.Starts[i], err)
+		}
+		if tmpl == nil {
+			tmpl = b.newLike()
+		}
+		slot := r.slot(s.Starts[i])
+		if s.Starts[i] > s.Latest || r.expired(s.Starts[i]) || r.buckets[slot] != nil {
+			return errors.New("loglogbeta: invalid windowed blob")
+		}
+		r.buckets[slot], r.starts[slot] = b, s.Starts[i]
+	}
+	if tmpl == nil {
+		tmpl = New()
+	}
+	r.tmpl = tmpl
+	*w = *r
+	return nil
+}
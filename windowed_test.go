@@ -0,0 +1,172 @@
+package loglogbeta
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWindowed(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	w := NewWindowed(time.Hour, time.Minute)
+	if w.Window() != time.Hour || w.Granularity() != time.Minute {
+		t.Fatalf("unexpected window %v/%v", w.Window(), w.Granularity())
+	}
+
+	// 1000 distinct elements a minute for two hours.
+	for min := 0; min < 120; min++ {
+		at := base.Add(time.Duration(min) * time.Minute)
+		for i := 0; i < 1000; i++ {
+			w.AddAt([]byte(strconv.Itoa(min*1000+i)), at)
+		}
+	}
+	if got := w.Cardinality(); estimateError(got, 60000) > 0.02 {
+		t.Errorf("window: expected about 60000, got %d", got)
+	}
+	last10 := base.Add(110 * time.Minute)
+	if got := w.CardinalitySince(last10); estimateError(got, 10000) > 0.02 {
+		t.Errorf("last 10 minutes: expected about 10000, got %d", got)
+	}
+	if got := w.CardinalitySince(base); estimateError(got, 60000) > 0.02 {
+		t.Errorf("since an expired time: expected the whole window, got %d", got)
+	}
+	if got := w.CardinalitySince(base.Add(3 * time.Hour)); got != 0 {
+		t.Errorf("since the future: expected 0, got %d", got)
+	}
+
+	// Adds older than the window are dropped; adds within it still count.
+	before := w.Cardinality()
+	for i := 0; i < 1000; i++ {
+		w.AddAt([]byte("old"+strconv.Itoa(i)), base)
+	}
+	if got := w.Cardinality(); got != before {
+		t.Errorf("expired adds changed the estimate from %d to %d", before, got)
+	}
+	w.AddAt([]byte("late"), base.Add(100*time.Minute))
+	if got := w.CardinalitySince(base.Add(100 * time.Minute)); got <= w.CardinalitySince(base.Add(101*time.Minute)) {
+		t.Errorf("late add within the window was dropped")
+	}
+
+	// Jumping far ahead expires everything but the new bucket.
+	w.AddAt([]byte("x"), base.Add(24*time.Hour))
+	if got := w.Cardinality(); got != 1 {
+		t.Errorf("after a jump: expected 1, got %d", got)
+	}
+
+	// Times before the epoch land in their own buckets.
+	e := NewWindowed(time.Second, time.Millisecond)
+	e.AddAt([]byte("a"), time.Unix(0, -1))
+	e.AddAt([]byte("b"), time.Unix(0, 0))
+	if got := e.CardinalitySince(time.Unix(0, 0)); got != 1 {
+		t.Errorf("epoch bucket: expected 1, got %d", got)
+	}
+
+	if got := NewWindowed(0, time.Minute).Window(); got != time.Minute {
+		t.Errorf("short window: expected one bucket, got %v", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a zero granularity")
+		}
+	}()
+	NewWindowed(time.Hour, 0)
+}
+
+func TestWindowedMerge(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := NewWindowed(10*time.Minute, time.Minute)
+	b := NewWindowed(10*time.Minute, time.Minute)
+	exp := NewWindowed(10*time.Minute, time.Minute)
+	for min := 0; min < 15; min++ {
+		at := base.Add(time.Duration(min) * time.Minute)
+		for i := 0; i < 500; i++ {
+			v := []byte(strconv.Itoa(min*1000 + i))
+			if min < 8 {
+				a.AddAt(v, at)
+			} else {
+				b.AddAt(v, at)
+			}
+			exp.AddAt(v, at)
+		}
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	for min := 0; min < 16; min++ {
+		at := base.Add(time.Duration(min) * time.Minute)
+		if got, want := a.CardinalitySince(at), exp.CardinalitySince(at); got != want {
+			t.Errorf("since minute %d: got %d, want %d", min, got, want)
+		}
+	}
+
+	if err := a.Merge(NewWindowed(10*time.Minute, time.Second)); !errors.Is(err, errWindowMismatch) {
+		t.Errorf("expected a window mismatch, got %v", err)
+	}
+	if err := a.Merge(NewWindowed(5*time.Minute, time.Minute)); !errors.Is(err, errWindowMismatch) {
+		t.Errorf("expected a window mismatch, got %v", err)
+	}
+	other := NewWindowed(10*time.Minute, time.Minute, WithHasherXXHash())
+	if err := a.Merge(other); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+}
+
+func TestWindowedRoundTrip(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	w := NewWindowed(5*time.Minute, time.Minute, WithSparseRegisters())
+	for min := 0; min < 8; min++ {
+		for i := 0; i < 100*(min+1); i++ {
+			w.AddAt([]byte(strconv.Itoa(min*1000+i)), base.Add(time.Duration(min)*time.Minute))
+		}
+	}
+	data, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]*Windowed{
+		"zero":       {},
+		"configured": NewWindowed(time.Hour, time.Second),
+	} {
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.Window() != w.Window() || got.Granularity() != w.Granularity() {
+			t.Errorf("%s: window %v/%v, want %v/%v", name, got.Window(), got.Granularity(), w.Window(), w.Granularity())
+		}
+		for min := 0; min < 9; min++ {
+			at := base.Add(time.Duration(min) * time.Minute)
+			if g, want := got.CardinalitySince(at), w.CardinalitySince(at); g != want {
+				t.Errorf("%s: since minute %d: got %d, want %d", name, min, g, want)
+			}
+		}
+		// The decoded window keeps sliding like the original.
+		got.AddAt([]byte("x"), base.Add(12*time.Minute))
+		if c := got.Cardinality(); c != 1 {
+			t.Errorf("%s: after sliding: expected 1, got %d", name, c)
+		}
+	}
+
+	empty, err := NewWindowed(time.Hour, time.Minute).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Windowed
+	if err := got.UnmarshalBinary(empty); err != nil || got.Cardinality() != 0 {
+		t.Errorf("empty window: got %d, %v", got.Cardinality(), err)
+	}
+
+	mismatched := NewWindowed(time.Hour, time.Minute, WithHasherXXHash())
+	if err := mismatched.UnmarshalBinary(data); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+	small := NewWindowed(time.Hour, time.Minute, WithPrecision(10))
+	if err := small.UnmarshalBinary(data); !errors.Is(err, ErrPrecisionMismatch) {
+		t.Errorf("expected a precision mismatch, got %v", err)
+	}
+	if err := new(Windowed).UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Error("expected an error for garbage")
+	}
+}